@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/config"
+)
+
+// configPath returns the path of the config file, which sets the defaults of
+// any flags. It's named like the cache directory.
+func configPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("os.UserConfigDir: %w", err)
+	}
+
+	return filepath.Join(dir, "git-branch-selector", "config"), nil
+}
+
+// readConfig reads the config file at path, which contains lines like
+//
+//	n = 25
+//	sort = "recent"
+//
+// where each key is the name of a flag, and returns the values. Keys can be
+// repeated, for flags like -protect which can be. Blank lines, and lines
+// starting with #, are ignored. A missing file is the same as an empty one.
+func readConfig(path string) (map[string][]string, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("os.Open: %w", err)
+	}
+	defer f.Close()
+
+	values := map[string][]string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: want key = value", path, n)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		if strings.HasPrefix(value, `"`) {
+			value, err = strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid string: %w", path, n, err)
+			}
+		}
+
+		values[key] = append(values[key], value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scanner.Err: %w", err)
+	}
+
+	return values, nil
+}
+
+// gitConfigSection is the section of git config which sets the defaults of any
+// flags, like:
+//
+//	[branch-selector]
+//		count = 25
+//		sort = recent
+const gitConfigSection = "branch-selector"
+
+// gitConfigAliases are the keys in git config which are named differently from
+// their flags, because the flag names are too terse.
+var gitConfigAliases = map[string]string{
+	"count": "n",
+}
+
+// gitConfigValues returns the values in the branch-selector section of cfg,
+// keyed by flag name.
+func gitConfigValues(cfg *config.Config) map[string][]string {
+	values := map[string][]string{}
+	for _, opt := range cfg.Raw.Section(gitConfigSection).Options {
+		key := strings.ToLower(opt.Key)
+		if name, ok := gitConfigAliases[key]; ok {
+			key = name
+		}
+
+		// like git, a key without a value is true.
+		value := opt.Value
+		if value == "" {
+			value = "true"
+		}
+
+		values[key] = append(values[key], value)
+	}
+
+	return values
+}
+
+// configured is the names of the flags given defaults by setDefaults.
+var configured = map[string]bool{}
+
+// setDefaults changes the defaults of the named flags to the given values, so
+// that flags on the command line still win. Unlike flag.Set, this doesn't count
+// as the flags being passed, for flag.Visit, but they're recorded in configured
+// so isFlagSet still sees them. Each value is set in order, so the last wins,
+// unless the flag can be repeated. src is where the values came from, for
+// errors.
+func setDefaults(src string, values map[string][]string) error {
+	for name, vs := range values {
+		f := flag.Lookup(name)
+		if f == nil {
+			return fmt.Errorf("%s: unknown flag %q", src, name)
+		}
+		configured[name] = true
+		for _, value := range vs {
+			if err := f.Value.Set(value); err != nil {
+				return fmt.Errorf("%s: invalid value %q for %s: %w", src, value, name, err)
+			}
+		}
+		f.DefValue = f.Value.String()
+	}
+
+	return nil
+}
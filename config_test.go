@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/config"
+)
+
+func TestReadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		want    map[string][]string
+		wantErr bool
+	}{
+		{"empty", "", map[string][]string{}, false},
+		{"plain", "n = 25\nsort=recent\n", map[string][]string{"n": {"25"}, "sort": {"recent"}}, false},
+		{"quoted", `cmd = "git log {}"`, map[string][]string{"cmd": {"git log {}"}}, false},
+		{"escaped", `separator = " \"|\" "`, map[string][]string{"separator": {` "|" `}}, false},
+		{"equals in value", "match = a=b", map[string][]string{"match": {"a=b"}}, false},
+		{"comments", "# n = 10\n\n  # indented\nn = 25", map[string][]string{"n": {"25"}}, false},
+		{"repeated", "protect = main\nprotect = release/*", map[string][]string{"protect": {"main", "release/*"}}, false},
+		{"no equals", "n 25", nil, true},
+		{"bad quote", `cmd = "git log`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config")
+			if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readConfig() err = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readConfig() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadConfigMissing(t *testing.T) {
+	got, err := readConfig(filepath.Join(t.TempDir(), "missing"))
+	if err != nil || got != nil {
+		t.Errorf("readConfig() = %v, %v, want nil, nil", got, err)
+	}
+}
+
+func TestGitConfigValues(t *testing.T) {
+	cfg := config.NewConfig()
+	err := cfg.Unmarshal([]byte(strings.Join([]string{
+		"[branch-selector]",
+		"\tcount = 25",
+		"\tSort = recent",
+		"\tprotect = main",
+		"\tprotect = release/*",
+		"\tgroup",
+		"[other]",
+		"\tcount = 10",
+	}, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		"n":       {"25"},
+		"sort":    {"recent"},
+		"protect": {"main", "release/*"},
+		"group":   {"true"},
+	}
+	if got := gitConfigValues(cfg); !reflect.DeepEqual(got, want) {
+		t.Errorf("gitConfigValues() = %v, want %v", got, want)
+	}
+}
+
+func TestSetDefaults(t *testing.T) {
+	n := flag.Int("test-n", 10, "")
+	var protect []string
+	flag.Var(patternsValue{&protect}, "test-protect", "")
+	t.Cleanup(func() { clear(configured) })
+
+	err := setDefaults("config", map[string][]string{
+		"test-n":       {"20", "25"},
+		"test-protect": {"main", "release/*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the last wins, unless the flag can be repeated.
+	if *n != 25 {
+		t.Errorf("test-n = %d, want 25", *n)
+	}
+	if want := []string{"main", "release/*"}; !slices.Equal(protect, want) {
+		t.Errorf("test-protect = %v, want %v", protect, want)
+	}
+
+	if got := flag.Lookup("test-n").DefValue; got != "25" {
+		t.Errorf("test-n DefValue = %q, want 25", got)
+	}
+	if got := slices.Sorted(maps.Keys(configured)); !slices.Equal(got, []string{"test-n", "test-protect"}) {
+		t.Errorf("configured = %v, want test-n and test-protect", got)
+	}
+	if !isFlagSet("test-n") {
+		t.Errorf("isFlagSet(test-n) = false, want true")
+	}
+}
+
+func TestSetDefaultsErrors(t *testing.T) {
+	flag.Int("test-bad", 10, "")
+	t.Cleanup(func() { clear(configured) })
+
+	tests := []struct {
+		name   string
+		values map[string][]string
+		want   string
+	}{
+		{"unknown flag", map[string][]string{"test-nope": {"1"}}, `config: unknown flag "test-nope"`},
+		{"invalid value", map[string][]string{"test-bad": {"x"}}, `config: invalid value "x" for test-bad`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := setDefaults("config", tt.values)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("setDefaults() err = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
@@ -1,282 +1,732 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
-	"sort"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
-	"syscall"
 	"time"
 
-	"github.com/mattn/go-tty"
-
-	"github.com/dustin/go-humanize"
+	"github.com/adammck/git-branch-selector/selector"
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/osfs"
 	git "github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/filesystem/dotgit"
 	"golang.org/x/term"
 )
 
-type List struct {
-	branches []Branch
-	selected int
+// the status to exit with, so scripts can tell why no branch was switched to.
+// log.Fatal exits with exitError, too.
+const (
+	exitError       = 1
+	exitCancelled   = 2
+	exitInterrupted = 130 // like the shell, after Ctrl-C
+)
+
+// branchJSON is the form of a Branch printed by the -json flag.
+type branchJSON struct {
+	Name    string    `json:"name"`
+	Hash    string    `json:"hash"`
+	Date    time.Time `json:"date"`
+	Subject string    `json:"subject"`
+	IsHead  bool      `json:"isHead"`
+	IsTag   bool      `json:"isTag"`
 }
 
-type Branch struct {
-	name    string
-	date    time.Time
-	subject string
-	isHead  bool
+func toJSON(b *selector.Branch) branchJSON {
+	return branchJSON{
+		Name:    b.Name,
+		Hash:    b.Hash.String(),
+		Date:    b.Date,
+		Subject: b.Subject,
+		IsHead:  b.IsHead,
+		IsTag:   b.IsTag,
+	}
 }
 
-func (b *Branch) when() string {
-	return humanize.Time(b.date)
+// trackingArgs returns the command to check out the given remote branch, by
+// creating a local branch to track it, or switching to the local branch if it
+// already exists.
+func trackingArgs(b *selector.Branch, useSwitch bool) []string {
+	verb, create := "checkout", "-b"
+	if useSwitch {
+		verb, create = "switch", "-c"
+	}
+
+	if b.HasLocal {
+		return []string{"git", verb, b.Local}
+	}
+
+	return []string{"git", verb, create, b.Local, "--track", b.Name}
 }
 
-// previous selects the branch prior to the one currently selected, or does nothing if the first branch is selected.
-func (l *List) previous() {
-	if l.selected > 0 {
-		l.selected--
+// worktreePath returns where to add a worktree for the named branch: a sibling of
+// the given worktree root, named after the branch, with any slashes replaced so
+// that it isn't nested.
+func worktreePath(root, branch string) string {
+	return filepath.Join(filepath.Dir(root), strings.ReplaceAll(branch, "/", "-"))
+}
+
+// worktreeArgs returns the command to add a new worktree at path for the given
+// branch. Like trackingArgs, remote branches get a local branch to track them,
+// unless one already exists.
+func worktreeArgs(b *selector.Branch, path string) []string {
+	if !b.IsRemote {
+		return []string{"git", "worktree", "add", path, b.Name}
+	}
+	if b.HasLocal {
+		return []string{"git", "worktree", "add", path, b.Local}
 	}
+
+	return []string{"git", "worktree", "add", "-b", b.Local, "--track", path, b.Name}
 }
 
-// next selects the branch after the one currently selected, or does nothing if the last branch is selected.
-func (l *List) next() {
-	if l.selected < len(l.branches)-1 {
-		l.selected++
+// detachArgs returns the command to check out the named commit, like a tag,
+// with a detached HEAD.
+func detachArgs(name string, useSwitch bool) []string {
+	if useSwitch {
+		return []string{"git", "switch", "--detach", name}
 	}
+
+	return []string{"git", "checkout", "--detach", name}
 }
 
-func (l *List) selectedName() string {
-	return l.branches[l.selected].name
+// commandArgs splits the given command template into arguments, replacing {} in
+// each of them with the branch name.
+func commandArgs(tmpl string, branch string) []string {
+	args := strings.Fields(tmpl)
+	for i := range args {
+		args[i] = strings.ReplaceAll(args[i], "{}", branch)
+	}
+
+	return args
 }
 
-func getBranches(repo *git.Repository, count int) (*List, error) {
-	branches := []Branch{}
+// shellSafe matches arguments which don't need to be quoted for sh.
+var shellSafe = regexp.MustCompile(`^[a-zA-Z0-9_./=:@+,-]+$`)
+
+// shellJoin quotes the given arguments, where necessary, to be run by sh.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if shellSafe.MatchString(arg) {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
 
-	iter, err := repo.Branches()
+	return strings.Join(quoted, " ")
+}
+
+// openRepo opens the repo at GIT_DIR if it's set, like git does, or otherwise
+// looks for one in the current directory and its parents.
+func openRepo() (*git.Repository, error) {
+	gitDir := os.Getenv("GIT_DIR")
+	if gitDir == "" {
+		repo, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{
+			DetectDotGit:          true,
+			EnableDotGitCommonDir: true,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("git.PlainOpenWithOptions: %w", err)
+		}
+		return repo, nil
+	}
+
+	// the work tree is the current directory, unless GIT_WORK_TREE says
+	// otherwise.
+	workTree := os.Getenv("GIT_WORK_TREE")
+	if workTree == "" {
+		workTree = "."
+	}
+
+	// linked worktrees keep most of their state in the main repo's git dir,
+	// which is named by their commondir file.
+	var fs billy.Filesystem = osfs.New(gitDir)
+	b, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+	if err == nil {
+		common := strings.TrimSpace(string(b))
+		if !filepath.IsAbs(common) {
+			common = filepath.Join(gitDir, common)
+		}
+		fs = dotgit.NewRepositoryFilesystem(fs, osfs.New(common))
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("os.ReadFile: %w", err)
+	}
+
+	repo, err := git.Open(filesystem.NewStorage(fs, cache.NewObjectLRUDefault()), osfs.New(workTree))
 	if err != nil {
-		return nil, fmt.Errorf("repo.Branches: %w", err)
+		return nil, fmt.Errorf("git.Open: %w", err)
 	}
 
-	headRef, err := repo.Head()
+	return repo, nil
+}
+
+// isDirty returns true if the worktree has uncommitted changes to tracked files.
+// Untracked files are ignored, since they don't usually get in the way of
+// switching branches.
+func isDirty(repo *git.Repository) (bool, error) {
+	wt, err := repo.Worktree()
 	if err != nil {
-		return nil, fmt.Errorf("repo.Head: %w", err)
+		return false, fmt.Errorf("repo.Worktree: %w", err)
 	}
 
-	err = iter.ForEach(func(ref *plumbing.Reference) error {
-		branchName := ref.Name().Short()
+	status, err := wt.Status()
+	if err != nil {
+		return false, fmt.Errorf("wt.Status: %w", err)
+	}
 
-		commit, err := repo.CommitObject(ref.Hash())
-		if err != nil {
-			return err
+	for _, fs := range status {
+		if fs.Worktree == git.Untracked {
+			continue
+		}
+		if fs.Staging != git.Unmodified || fs.Worktree != git.Unmodified {
+			return true, nil
 		}
+	}
 
-		subject, _, _ := strings.Cut(commit.Message, "\n")
-		isHead := ref.Hash() == headRef.Hash()
+	return false, nil
+}
 
-		branches = append(branches, Branch{
-			name:    branchName,
-			date:    commit.Committer.When,
-			subject: subject,
-			isHead:  isHead,
-		})
+// stdin is shared by everything which reads lines from stdin, so that nothing
+// is lost in the buffer of a reader which is no longer used.
+var stdin = bufio.NewReader(os.Stdin)
 
-		return nil
-	})
+// askYesNo prints the question, and returns true if the user answers y.
+func askYesNo(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
 
+	answer, err := stdin.ReadString('\n')
 	if err != nil {
-		return nil, fmt.Errorf("iter.ForEach: %w", err)
+		return false
 	}
 
-	sort.Slice(branches, func(i, j int) bool {
-		return branches[i].date.After(branches[j].date)
-	})
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
 
-	// truncate to first n
-	if len(branches) > count {
-		branches = branches[:count]
+// parseDuration is like time.ParseDuration, but also understands days (d) and
+// weeks (w), like 7d or 2w.
+func parseDuration(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		n, ok := strings.CutSuffix(s, suffix)
+		if !ok {
+			continue
+		}
+		f, err := strconv.ParseFloat(n, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(f * float64(unit)), nil
 	}
 
-	return &List{
-		branches: branches,
-		selected: 0,
-	}, nil
+	return time.ParseDuration(s)
+}
+
+// durationValue is a flag.Value for durations parsed by parseDuration.
+type durationValue struct {
+	d *time.Duration
+}
+
+func (v durationValue) String() string {
+	if v.d == nil || *v.d == 0 {
+		return ""
+	}
+	return v.d.String()
 }
 
-func termWidth() int {
-	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+func (v durationValue) Set(s string) error {
+	d, err := parseDuration(s)
 	if err != nil {
-		return 80 // default
+		return err
 	}
-	return width
+	*v.d = d
+	return nil
 }
 
-func printBranches(list *List) uint8 {
-	// build the contents of the table, unaligned
-	var rows [][3]string
-	for _, branch := range list.branches {
-		rows = append(rows, [3]string{
-			branch.name,
-			branch.when(),
-			branch.subject,
-		})
+// revisionValue is a flag.Value for a revision which can be left out, like
+// -merged, in which case it's the base branch. Like a bool flag, -merged=false
+// turns it off, so a branch named true or false must be given as heads/true.
+type revisionValue struct {
+	rev *string
+}
+
+func (v revisionValue) String() string {
+	if v.rev == nil || *v.rev == selector.BaseBranch {
+		return ""
 	}
+	return *v.rev
+}
 
-	// find the maximum width for each column
-	var cw [3]int
-	for _, row := range rows {
-		for c, col := range row {
-			if len(col) > cw[c] {
-				cw[c] = len(col)
-			}
-		}
+func (v revisionValue) Set(s string) error {
+	switch s {
+	case "true":
+		s = selector.BaseBranch
+	case "false":
+		s = ""
 	}
+	*v.rev = s
+	return nil
+}
 
-	tw := termWidth()
+// IsBoolFlag lets the flag be given without a value.
+func (v revisionValue) IsBoolFlag() bool {
+	return true
+}
+
+// patternsValue is a flag.Value for a list of globs, like main or release/*. It
+// can be repeated, and each can be a comma-separated list.
+type patternsValue struct {
+	patterns *[]string
+}
 
-	// print the table with aligned columns, leaving space for asterisk
-	for _, row := range rows {
-		line := fmt.Sprintf("   %-*s  |  %-*s  |  %-*s",
-			cw[0], row[0], // indicator
-			cw[1], row[1], // branch name
-			cw[2], row[2]) // when
+func (v patternsValue) String() string {
+	if v.patterns == nil {
+		return ""
+	}
+	return strings.Join(*v.patterns, ",")
+}
 
-		if len(line) > tw {
-			line = line[:tw]
+func (v patternsValue) Set(s string) error {
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", p, err)
 		}
+		*v.patterns = append(*v.patterns, p)
+	}
+	return nil
+}
 
-		// include carriage return, to move to column zero before moving down a
-		// row. this is necessary in raw mode.
-		fmt.Printf(line + "\r\n")
+// isProtected returns true if the branch matches any of the patterns. Remote
+// branches are matched by the name of their local branch, too, so main protects
+// origin/main.
+func isProtected(b *selector.Branch, patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, b.Name); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, b.Local); ok && b.IsRemote {
+			return true
+		}
 	}
 
-	return uint8(len(rows))
+	return false
 }
 
-func printSelected(list *List) {
-	fmt.Printf("\x1b[%dA", len(list.branches))
+// versionRequested returns true if -version or --version is among the given
+// arguments, before any --. The value of another flag, like -cmd -version, is
+// taken as -version too, which is close enough.
+func versionRequested(args []string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			return false
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
 
-	for i := 0; i < len(list.branches); i++ {
-		indicator := "   "
-		if i == list.selected {
-			indicator = " * "
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != "version" {
+			continue
+		}
+		if !hasValue {
+			return true
 		}
-		fmt.Printf("%s\r\n", indicator)
+		b, err := strconv.ParseBool(value)
+		return err == nil && b
 	}
+
+	return false
+}
+
+// isFlagSet returns true if the named flag was passed on the command line, or
+// set in config, rather than left at its default.
+func isFlagSet(name string) bool {
+	set := configured[name]
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+
+	return set
 }
 
 func main() {
-	count := flag.Int("n", 10, "number of branches")
+	opts := selector.Options{}
+	flag.IntVar(&opts.Count, "n", 10, "number of branches, or 0 for all of them")
+	flag.BoolVar(&opts.Wrap, "wrap", false, "wrap around when moving past either end of the list")
+	flag.BoolVar(&opts.SkipHead, "skip-head", false, "don't start on the branch which is already checked out")
+	flag.BoolVar(&opts.Remember, "remember", true, "start on the branch chosen last time")
+	flag.BoolVar(&opts.NoMouse, "no-mouse", false, "don't select branches by clicking, so the mouse can select text as usual")
+	flag.BoolVar(&opts.Remote, "remote", false, "include remote-tracking branches")
+	flag.BoolVar(&opts.Tags, "tags", false, "include tags, which are checked out with a detached HEAD")
+	flag.BoolVar(&opts.NoCurrent, "no-current", false, "hide the branch which is already checked out")
+	flag.StringVar(&opts.Pattern, "pattern", "", "only show branches matching this glob, like feature/*")
+	regex := flag.String("regex", "", "only show branches matching this regular expression")
+	authoredBy := flag.String("authored-by", "", "only show branches whose last commit's author name or email matches this regular expression")
+	flag.StringVar(&opts.Sort, "sort", "date", "sort order: date, recent, name, or name-desc")
+	flag.BoolVar(&opts.Reverse, "reverse", false, "reverse the sort order")
+	flag.StringVar(&opts.Match, "match", "fuzzy", "how the filter matches branch names: fuzzy, or substring")
+	flag.BoolVar(&opts.Group, "group", false, "group branches by the prefix before the first slash")
+	flag.BoolVar(&opts.NoHash, "no-hash", false, "hide the commit hash column")
+	flag.BoolVar(&opts.Upstream, "upstream", false, "show the upstream branch column")
+	flag.BoolVar(&opts.Commits, "commits", false, "show how many commits each branch has which the default branch doesn't")
+	flag.BoolVar(&opts.Author, "author", false, "show the commit author column")
+	flag.IntVar(&opts.SubjectWidth, "subject-width", 50, "truncate commit subjects to this many columns, or 0 for no limit")
+	flag.BoolVar(&opts.HeadMarker, "head-marker", false, "mark the branch which is checked out with •, next to its name")
+	flag.BoolVar(&opts.FullRef, "full-ref", false, "show the full ref name of each branch, like refs/heads/main")
+	flag.IntVar(&opts.MinNameWidth, "min-name-width", 0, "pad branch names to at least this many columns")
+	flag.IntVar(&opts.MaxNameWidth, "max-name-width", 0, "truncate branch names to this many columns, or 0 for no limit")
+	flag.Var(durationValue{&opts.Stale}, "stale", "flag branches with no commits within this long as stale, like 90d")
+	columns := flag.String("columns", "", "the columns to show, in order, like date,name,subject. any of: name, hash, upstream, tracking, commits, date, author, subject")
+	flag.StringVar(&opts.Separator, "separator", "|", "what to show between columns")
+	flag.BoolVar(&opts.NoSeparator, "no-separator", false, "separate columns with just space")
+	flag.StringVar(&opts.Date, "date", "relative", "date format: relative, iso, short, or compact (like 3d)")
+	cmd := flag.String("cmd", "git checkout {}", "command to run, where {} is replaced by the selected branch name")
+	useSwitch := flag.Bool("switch", false, "use git switch rather than git checkout")
+	quiet := flag.Bool("quiet", false, "don't print the command before running it, or anything while loading")
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	detach := flag.Bool("detach", false, "check out the selected branch with a detached HEAD, rather than moving onto it")
+	worktree := flag.Bool("worktree", false, "add a worktree for the selected branch, next to this one, rather than checking it out")
+	colorMode := flag.String("color", "auto", "when to use color: never, always, or auto")
+	force := flag.Bool("force", false, "switch without confirming when the working tree has uncommitted changes")
+	stash := flag.Bool("stash", false, "stash uncommitted changes before switching. they're left in the stash, to pop on the other branch")
+	printName := flag.Bool("print", false, "print the selected branch name instead of checking it out")
+	printJSON := flag.Bool("json", false, "print the selected branch as JSON instead of checking it out")
+	pull := flag.Bool("pull", false, "pull the branch after switching to it, if it can be fast-forwarded")
+	var protect []string
+	flag.Var(patternsValue{&protect}, "protect", "confirm before switching to branches matching these globs, like main,release/*. can be repeated")
+	dryRun := flag.Bool("dry-run", false, "print the command which would be run, rather than running it")
+	flag.Var(revisionValue{&opts.Merged}, "merged", "only show branches which have been merged into this revision, like -merged=v1.0, or the base branch if none is given")
+	flag.Var(revisionValue{&opts.NoMerged}, "no-merged", "only show branches which haven't been merged into this revision, like -no-merged=v1.0, or the base branch if none is given")
+	flag.StringVar(&opts.Base, "base", "", "the branch which others are based on, for -merged, -commits, etc. the default is origin/HEAD, main, or master")
+	flag.StringVar(&opts.Contains, "contains", "", "only show branches which contain this commit")
+	flag.Var(durationValue{&opts.Since}, "since", "only show branches with commits within this long, like 7d or 2w")
+	flag.Var(durationValue{&opts.Before}, "before", "only show branches with no commits within this long, like 90d")
+	flag.BoolVar(&opts.Cache, "cache", false, "cache branches between runs, and reuse them if no refs have changed")
+	flag.BoolVar(&opts.Fetch, "fetch", false, "fetch from all remotes before listing branches")
+
+	// this is checked before reading any config, so -version still works if
+	// it's broken.
+	if versionRequested(os.Args[1:]) {
+		fmt.Println(versionString())
+		return
+	}
+
+	// read the defaults from the config file, if there is one, before
+	// parsing the command line, which overrides them.
+	if path, err := configPath(); err == nil {
+		values, err := readConfig(path)
+		if err != nil {
+			log.Fatalf("readConfig: %s", err)
+		}
+		if err := setDefaults(path, values); err != nil {
+			log.Fatalf("setDefaults: %s", err)
+		}
+	}
+
+	// then from git config, first global and then the repo's own, so it can
+	// override them. if there's no repo, that's reported after parsing, so -h
+	// still works outside of one.
+	repo, repoErr := openRepo()
+	if global, err := config.LoadConfig(config.GlobalScope); err == nil {
+		if err := setDefaults("global git config", gitConfigValues(global)); err != nil {
+			log.Fatalf("setDefaults: %s", err)
+		}
+	}
+	if repoErr == nil {
+		local, err := repo.Config()
+		if err != nil {
+			log.Fatalf("repo.Config: %s", err)
+		}
+		if err := setDefaults("git config", gitConfigValues(local)); err != nil {
+			log.Fatalf("setDefaults: %s", err)
+		}
+	}
+
 	flag.Parse()
 
-	// just to avoid any confusion.
-	if !term.IsTerminal(int(os.Stdout.Fd())) {
-		log.Fatal("stdout is not a tty")
+	// -merged and -no-merged can be given without a value, so a value after
+	// them with a space looks like an argument. there aren't any others.
+	if flag.NArg() > 0 {
+		log.Fatalf("unexpected argument: %q (use -merged=REV to give a revision)", flag.Arg(0))
 	}
 
-	branch := prompt(*count)
-	if branch == "" {
+	// this doesn't need a terminal, or a repo.
+	if *showVersion {
+		fmt.Println(versionString())
 		return
 	}
 
-	path, err := exec.LookPath("git")
-	if err != nil {
-		log.Fatalf("exec.LookPath: %s", err)
+	switch opts.Date {
+	case "relative", "iso", "short", "compact":
+	default:
+		log.Fatalf("invalid -date: %q (want relative, iso, short, or compact)", opts.Date)
 	}
 
-	fmt.Println()
+	if *regex != "" {
+		re, err := regexp.Compile(*regex)
+		if err != nil {
+			log.Fatalf("invalid -regex: %s", err)
+		}
+		opts.Regex = re
+	}
 
-	args := []string{"git", "checkout", branch}
-	fmt.Printf("+ %v\n", strings.Join(args, " "))
+	if opts.Pattern != "" {
+		if _, err := path.Match(opts.Pattern, ""); err != nil {
+			log.Fatalf("invalid -pattern: %s", err)
+		}
+	}
 
-	err = syscall.Exec(path, args, os.Environ())
-	if err != nil {
-		log.Fatalf("syscall.Exec: %s", err)
+	if *columns != "" {
+		for _, c := range strings.Split(*columns, ",") {
+			c = strings.TrimSpace(c)
+			if !slices.Contains(selector.ColumnNames, c) {
+				log.Fatalf("invalid -columns: %q (want %s)", c, strings.Join(selector.ColumnNames, ", "))
+			}
+			opts.Columns = append(opts.Columns, c)
+		}
 	}
-}
 
-func prompt(count int) string {
-	repo, err := git.PlainOpen(".")
-	if err != nil {
-		log.Fatalf("git.PlainOpen: %s", err)
+	if opts.MaxNameWidth > 0 && opts.MinNameWidth > opts.MaxNameWidth {
+		log.Fatal("-min-name-width can't be more than -max-name-width")
 	}
 
-	branches, err := getBranches(repo, count)
-	if err != nil {
-		log.Fatalf("getBranches: %s", err)
+	if *authoredBy != "" {
+		re, err := regexp.Compile("(?i)" + *authoredBy)
+		if err != nil {
+			log.Fatalf("invalid -authored-by: %s", err)
+		}
+		opts.AuthoredBy = re
 	}
 
-	t, err := tty.Open()
-	if err != nil {
-		log.Fatalf("tty.Open: %s", err)
+	tmpl := *cmd
+	if *useSwitch {
+		if isFlagSet("cmd") {
+			log.Fatal("-switch and -cmd can't be used together")
+		}
+		tmpl = "git switch {}"
 	}
-	defer func() {
-		err := t.Close()
-		if err != nil {
-			log.Fatalf("t.Close: %s", err)
+	if *worktree && (isFlagSet("cmd") || *useSwitch) {
+		log.Fatal("-worktree can't be used with -cmd or -switch")
+	}
+	if *detach && (isFlagSet("cmd") || *worktree) {
+		log.Fatal("-detach can't be used with -cmd or -worktree")
+	}
+
+	// the checkout runs git after the prompt, so check for it first rather than
+	// failing once a branch has been chosen. printing doesn't need it at all.
+	needGit := !isFlagSet("cmd") || *stash || *pull
+	if needGit && !*printName && !*printJSON && !*dryRun {
+		if _, err := exec.LookPath("git"); err != nil {
+			log.Fatal("git not found in PATH; install it from https://git-scm.com, or use -print to just print the branch name")
 		}
-	}()
+	}
 
-	// put terminal into raw mode, so we can listen for keys.
-	revert, err := t.Raw()
+	// when printing the branch, stdout is probably being captured by a script,
+	// so draw the prompt on the terminal instead.
+	ui := os.Stdout
+	if *printName || *printJSON {
+		if t, err := os.OpenFile(ttyPath, os.O_WRONLY, 0); err == nil {
+			defer t.Close()
+			ui = t
+		}
+	}
+	opts.Output = ui
+	opts.Quiet = *quiet
+
+	// without a terminal, we can't draw the prompt, so fall back to printing
+	// a numbered list. print it to stderr if stdout is for the result.
+	interactive := term.IsTerminal(int(ui.Fd()))
+	listOut := os.Stdout
+	if *printName || *printJSON {
+		listOut = os.Stderr
+	}
+
+	switch *colorMode {
+	case "never":
+		opts.Color = false
+	case "always":
+		opts.Color = true
+	case "auto":
+		opts.Color = os.Getenv("NO_COLOR") == "" && term.IsTerminal(int(ui.Fd()))
+	default:
+		log.Fatalf("invalid -color: %q (want never, always, or auto)", *colorMode)
+	}
+
+	if repoErr != nil {
+		log.Fatalf("openRepo: %s", repoErr)
+	}
+
+	var chosen []selector.Branch
+	var err error
+	if interactive {
+		chosen, err = selector.SelectBranches(repo, opts)
+	} else {
+		var b *selector.Branch
+		b, err = selector.SelectNumbered(repo, opts, listOut, stdin)
+		if b != nil {
+			chosen = []selector.Branch{*b}
+		}
+	}
+	if errors.Is(err, selector.ErrInterrupted) {
+		os.Exit(exitInterrupted)
+	}
+	if errors.Is(err, selector.ErrNoBranches) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitError)
+	}
 	if err != nil {
-		log.Fatalf("t.Raw: %s", err)
+		log.Fatalf("selector: %s", err)
 	}
-	defer func() {
-		err := revert()
-		if err != nil {
-			log.Fatalf("revert: %s", err)
-		}
-	}()
-
-	// print the table containing all the info. we only do this once, because
-	// the only thing that changes every keypress is the position of the
-	// selected marker.
-	printBranches(branches)
-
-	for {
-		// erase any previously-printed markers, and print the current one.
-		printSelected(branches)
-
-		// read one keypress
-		// damn this is complicated
-		// see: https://www.asciitable.com
-		buf := []rune{}
-		for {
-			r, err := t.ReadRune()
-			if err != nil {
-				log.Fatalf("t.ReadRune: %s", err)
-			}
-			if r == 0 {
-				continue
-			}
-			buf = append(buf, r)
-			if !t.Buffered() {
-				break
+
+	// we can only switch to one branch, so if several were marked, print
+	// them instead, one per line.
+	if *printName || *printJSON || len(chosen) > 1 {
+		if len(chosen) == 0 {
+			os.Exit(exitCancelled)
+		}
+
+		if *printJSON {
+			enc := json.NewEncoder(os.Stdout)
+			for i := range chosen {
+				err = enc.Encode(toJSON(&chosen[i]))
+				if err != nil {
+					log.Fatalf("json.Encode: %s", err)
+				}
 			}
+			return
 		}
 
-		// to exit, press: ETX, ESC, Q, or q
-		// ETX (end of text) is received when ctrl+c is pressed.
-		if len(buf) == 1 && (buf[0] == 3 || buf[0] == 27 || buf[0] == 'Q' || buf[0] == 'q') {
-			return ""
+		for _, b := range chosen {
+			fmt.Println(b.Name)
 		}
+		return
+	}
 
-		// press Enter (CR) to switch to selected branch and exit
-		if len(buf) == 1 && buf[0] == 13 {
-			return branches.selectedName()
+	if len(chosen) == 0 {
+		os.Exit(exitCancelled)
+	}
+	branch := &chosen[0]
+
+	// git won't check out a branch which is already checked out somewhere
+	// else, so explain why rather than letting it fail.
+	if branch.Worktree != "" && !isFlagSet("cmd") && !*detach {
+		log.Fatalf("%s is already checked out in %s", branch.Name, branch.Worktree)
+	}
+
+	// protected branches are easy to commit to by mistake, so check that
+	// switching to one was deliberate.
+	if isProtected(branch, protect) && !*dryRun {
+		if !askYesNo(fmt.Sprintf("%s is protected. Switch anyway?", branch.Name)) {
+			os.Exit(exitCancelled)
 		}
+	}
 
-		// press up/down to change selected branch
-		if len(buf) == 3 && (buf[0] == 27 && buf[1] == '[') {
-			if buf[2] == 'A' { // up
-				branches.previous()
-			} else if buf[2] == 'B' { // down
-				branches.next()
-			}
+	// switching branches with uncommitted changes might fail, or carry them
+	// over to the other branch, so check first. adding a worktree leaves this
+	// one alone, so it doesn't matter there.
+	dirty := false
+	if !*worktree && (!*force || *stash) {
+		dirty, err = isDirty(repo)
+		if err != nil {
+			log.Fatalf("isDirty: %s", err)
+		}
+	}
+	if dirty && !*force && !*stash && !*dryRun {
+		if !askYesNo("The working tree has uncommitted changes. Switch anyway?") {
+			os.Exit(exitCancelled)
+		}
+	}
+
+	args := commandArgs(tmpl, branch.Name)
+	if branch.IsRemote && !isFlagSet("cmd") {
+		args = trackingArgs(branch, *useSwitch)
+	}
+	if (branch.IsTag || *detach) && !isFlagSet("cmd") {
+		args = detachArgs(branch.Name, *useSwitch)
+	}
+	// where the branch is checked out, if not here.
+	dir := ""
+	if *worktree {
+		wt, err := repo.Worktree()
+		if err != nil {
+			log.Fatalf("repo.Worktree: %s", err)
+		}
+		root, err := filepath.Abs(wt.Filesystem.Root())
+		if err != nil {
+			log.Fatalf("filepath.Abs: %s", err)
+		}
+		name := branch.Name
+		if branch.IsRemote {
+			name = branch.Local
 		}
+		dir = worktreePath(root, name)
+		args = worktreeArgs(branch, dir)
+	}
+	if len(args) == 0 {
+		log.Fatal("-cmd is empty")
+	}
+
+	// commands to run before and after the checkout. we're about to replace
+	// this process, so if there are any, run them all in a shell.
+	var before, after []string
+	if dirty && *stash {
+		before = append(before, "git stash push")
+	}
+	if *pull && !branch.IsTag && !*detach {
+		// a failed pull doesn't undo the checkout, so don't fail because of
+		// it. git explains what went wrong.
+		cmd := "git pull --ff-only"
+		if dir != "" {
+			cmd = shellJoin([]string{"git", "-C", dir, "pull", "--ff-only"})
+		}
+		after = append(after, "{ "+cmd+" || true; }")
+	}
+
+	display := strings.Join(args, " ")
+	if len(before) > 0 || len(after) > 0 {
+		script := append(append(before, shellJoin(args)), after...)
+		args = []string{"sh", "-c", strings.Join(script, " && ")}
+		display = args[2]
+	}
+
+	if *dryRun {
+		fmt.Printf("+ %v\n", display)
+		return
+	}
+
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		log.Fatalf("exec.LookPath: %s", err)
+	}
+
+	if !*quiet {
+		fmt.Println()
+		fmt.Printf("+ %v\n", display)
+	}
+
+	err = execCommand(path, args)
+	if err != nil {
+		log.Fatalf("execCommand: %s", err)
 	}
 }
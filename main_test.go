@@ -0,0 +1,138 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/adammck/git-branch-selector/selector"
+)
+
+func TestShellJoin(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"git", "checkout", "feature/login"}, "git checkout feature/login"},
+		{[]string{"echo", "a b"}, "echo 'a b'"},
+		{[]string{"echo", "it's"}, `echo 'it'\''s'`},
+		{[]string{"echo", "$HOME"}, "echo '$HOME'"},
+		{[]string{"echo", "日本語"}, "echo '日本語'"},
+	}
+
+	for _, tt := range tests {
+		if got := shellJoin(tt.args); got != tt.want {
+			t.Errorf("shellJoin(%q) = %s, want %s", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"90m", 90 * time.Minute, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"1.5d", 36 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"xd", 0, true},
+		{"w", 0, true},
+		{"7", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseDuration(tt.s)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("parseDuration(%q) = %v, %v, want %v, error %v", tt.s, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestPatternsValue(t *testing.T) {
+	var patterns []string
+	v := patternsValue{&patterns}
+	for _, s := range []string{"main", " release/*, hotfix/* ,", ""} {
+		if err := v.Set(s); err != nil {
+			t.Fatalf("Set(%q) = %v", s, err)
+		}
+	}
+
+	if want := []string{"main", "release/*", "hotfix/*"}; !slices.Equal(patterns, want) {
+		t.Errorf("patterns = %v, want %v", patterns, want)
+	}
+	if got := v.String(); got != "main,release/*,hotfix/*" {
+		t.Errorf("String() = %q", got)
+	}
+
+	if err := v.Set("[main"); err == nil {
+		t.Errorf("Set(%q) = nil, want error", "[main")
+	}
+}
+
+func TestIsProtected(t *testing.T) {
+	patterns := []string{"main", "release/*"}
+	tests := []struct {
+		branch selector.Branch
+		want   bool
+	}{
+		{selector.Branch{Name: "main"}, true},
+		{selector.Branch{Name: "release/1.0"}, true},
+		{selector.Branch{Name: "release/1.0/fix"}, false},
+		{selector.Branch{Name: "feature/main"}, false},
+		{selector.Branch{Name: "origin/main", Local: "main", IsRemote: true}, true},
+		{selector.Branch{Name: "origin/release/1.0", Local: "release/1.0", IsRemote: true}, true},
+		{selector.Branch{Name: "origin/feature", Local: "feature", IsRemote: true}, false},
+
+		// Local is only used for remote branches.
+		{selector.Branch{Name: "other", Local: "main"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := isProtected(&tt.branch, patterns); got != tt.want {
+			t.Errorf("isProtected(%q) = %v, want %v", tt.branch.Name, got, tt.want)
+		}
+	}
+}
+
+func TestRevisionValue(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"true", selector.BaseBranch},
+		{"false", ""},
+		{"v1.0", "v1.0"},
+		{"heads/true", "heads/true"},
+	}
+
+	for _, tt := range tests {
+		rev := "before"
+		if err := (revisionValue{&rev}).Set(tt.s); err != nil || rev != tt.want {
+			t.Errorf("Set(%q) = %v, rev %q, want %q", tt.s, err, rev, tt.want)
+		}
+	}
+}
+
+func TestVersionRequested(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{nil, false},
+		{[]string{"-version"}, true},
+		{[]string{"--version"}, true},
+		{[]string{"-version=true"}, true},
+		{[]string{"-version=false"}, false},
+		{[]string{"-n", "25", "-version"}, true},
+		{[]string{"-versions"}, false},
+		{[]string{"--", "-version"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := versionRequested(tt.args); got != tt.want {
+			t.Errorf("versionRequested(%q) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
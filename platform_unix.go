@@ -0,0 +1,24 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// ttyPath is the file to open to write to the terminal, even if stdout has been
+// redirected.
+const ttyPath = "/dev/tty"
+
+// execCommand replaces this process with the given command, so that it has the
+// terminal to itself, and its exit status is ours. It only returns on error.
+func execCommand(path string, args []string) error {
+	err := syscall.Exec(path, args, os.Environ())
+	if err != nil {
+		return fmt.Errorf("syscall.Exec: %w", err)
+	}
+
+	return nil
+}
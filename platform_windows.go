@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// ttyPath is the file to open to write to the console, even if stdout has been
+// redirected.
+const ttyPath = "CONOUT$"
+
+// execCommand runs the given command and exits with its status. Windows can't
+// replace the running process, so this is the closest it gets to exec. It only
+// returns on error.
+func execCommand(path string, args []string) error {
+	cmd := exec.Command(path, args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		return fmt.Errorf("cmd.Run: %w", err)
+	}
+
+	os.Exit(0)
+	return nil
+}
@@ -0,0 +1,1243 @@
+package selector
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-git/go-billy/v5"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"golang.org/x/sync/errgroup"
+)
+
+// withHeaders returns a copy of the given branches, which should already be
+// grouped, with a header before each group of branches with the same prefix.
+func withHeaders(branches []Branch) []Branch {
+	out := []Branch{}
+	prev := ""
+
+	for _, b := range branches {
+		if p := b.prefix(); p != prev && p != "" {
+			out = append(out, Branch{Name: p + "/", isHeader: true})
+		}
+		out = append(out, b)
+		prev = b.prefix()
+	}
+
+	return out
+}
+
+// groupBranches reorders the given branches in place so that those with the
+// same prefix are together, ordered by the first branch of each group, and
+// otherwise preserving the order. Branches without a prefix come first.
+func groupBranches(branches []Branch) {
+	rank := map[string]int{"": -1}
+	for i, b := range branches {
+		if _, ok := rank[b.prefix()]; !ok {
+			rank[b.prefix()] = i
+		}
+	}
+
+	sort.SliceStable(branches, func(i, j int) bool {
+		return rank[branches[i].prefix()] < rank[branches[j].prefix()]
+	})
+}
+
+// branchRef is a ref to be listed by getBranches.
+type branchRef struct {
+	ref      *plumbing.Reference
+	isRemote bool
+	isTag    bool
+}
+
+// independent returns a copy of repo with its own object storage, so it can be
+// read from concurrently with repo. go-git's filesystem storage isn't safe for
+// concurrent use, but opening it again is cheap.
+func independent(repo *git.Repository) (*git.Repository, error) {
+	s, ok := repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil, fmt.Errorf("unsupported storage: %T", repo.Storer)
+	}
+
+	return git.Open(filesystem.NewStorage(s.Filesystem(), cache.NewObjectLRUDefault()), nil)
+}
+
+// loadBranches calls load for each of refs, with a few workers each with their
+// own storage, since it's mostly waiting on the disk. The branches are returned
+// in the same order as refs, so sorting them is deterministic. Refs pointing to
+// missing objects, like after an interrupted fetch, are left out, and returned.
+// Any other error from load is returned.
+func loadBranches(repo *git.Repository, refs []branchRef, load func(*git.Repository, branchRef) (Branch, error)) ([]Branch, []branchRef, error) {
+	branches := make([]Branch, len(refs))
+	failed := make([]bool, len(refs))
+	next := make(chan int)
+	g, ctx := errgroup.WithContext(context.Background())
+
+	g.Go(func() error {
+		defer close(next)
+		for i := range refs {
+			select {
+			case next <- i:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		return nil
+	})
+
+	for range min(runtime.NumCPU(), len(refs)) {
+		g.Go(func() (err error) {
+			// don't let a panic kill the process, since this can happen
+			// while the prompt is shown, with the terminal in raw mode.
+			defer func() {
+				if r := recover(); r != nil {
+					err = recovered(r)
+				}
+			}()
+
+			r, err := independent(repo)
+			if err != nil {
+				return fmt.Errorf("independent: %w", err)
+			}
+
+			for i := range next {
+				branches[i], err = load(r, refs[i])
+				if errors.Is(err, plumbing.ErrObjectNotFound) {
+					failed[i] = true
+				} else if err != nil {
+					return fmt.Errorf("%s: %w", refs[i].ref.Name().Short(), err)
+				}
+			}
+
+			return nil
+		})
+	}
+
+	err := g.Wait()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var skipped []branchRef
+	for i := len(refs) - 1; i >= 0; i-- {
+		if failed[i] {
+			skipped = append(skipped, refs[i])
+			branches = slices.Delete(branches, i, i+1)
+		}
+	}
+	slices.Reverse(skipped)
+
+	return branches, skipped, nil
+}
+
+// cachedBranch is how a Branch is stored in the cache written by -cache.
+type cachedBranch struct {
+	Name     string    `json:"name"`
+	Hash     string    `json:"hash"`
+	Date     time.Time `json:"date"`
+	Author   string    `json:"author"`
+	Email    string    `json:"email"`
+	Subject  string    `json:"subject"`
+	IsHead   bool      `json:"isHead"`
+	IsRemote bool      `json:"isRemote"`
+	Local    string    `json:"local"`
+	HasLocal bool      `json:"hasLocal"`
+	Upstream string    `json:"upstream"`
+	Ahead    int       `json:"ahead"`
+	Behind   int       `json:"behind"`
+	Gone     bool      `json:"gone"`
+	IsTag    bool      `json:"isTag"`
+
+	Commits    int  `json:"commits"`
+	HasCommits bool `json:"hasCommits"`
+}
+
+// cacheVersion is part of the cache key, so that caches written before a change
+// to cachedBranch aren't read. Increment it whenever the fields change.
+const cacheVersion = 4
+
+// branchCache is the file written by -cache.
+type branchCache struct {
+	// key identifies the state of the repo which the branches were read
+	// from. See cacheKey.
+	Key      string         `json:"key"`
+	Branches []cachedBranch `json:"branches"`
+}
+
+// cacheKey returns a hash of everything which the branches listed by
+// getBranches depend on: every ref, the branch config, and the options which
+// change which refs are read, and base, which the commits are counted from, if
+// they are. If it's the same as last time, so are they.
+func cacheKey(repo *git.Repository, cfg *config.Config, opts Options, base *plumbing.Reference) (string, error) {
+	lines := []string{
+		fmt.Sprintf("version %d", cacheVersion),
+		fmt.Sprintf("remote %v", opts.Remote),
+		fmt.Sprintf("tags %v", opts.Tags),
+		fmt.Sprintf("commits %v", opts.countCommits()),
+	}
+	if base != nil {
+		lines = append(lines, "base "+base.String())
+	}
+
+	iter, err := repo.References()
+	if err != nil {
+		return "", fmt.Errorf("repo.References: %w", err)
+	}
+
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		lines = append(lines, ref.String())
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("iter.ForEach: %w", err)
+	}
+
+	// HEAD isn't always included by References.
+	head, err := repo.Storer.Reference(plumbing.HEAD)
+	if err == nil {
+		lines = append(lines, head.String())
+	}
+
+	for name, b := range cfg.Branches {
+		lines = append(lines, fmt.Sprintf("branch %s %s %s", name, b.Remote, b.Merge))
+	}
+
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// cachePath returns the path of a cache file for repo, with the given extension.
+// Each repo gets its own files, named after a hash of the path to its git dir.
+func cachePath(repo *git.Repository, ext string) (string, error) {
+	s, ok := repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return "", fmt.Errorf("unsupported storage: %T", repo.Storer)
+	}
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	root, err := filepath.Abs(s.Filesystem().Root())
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(dir, "git-branch-selector", hex.EncodeToString(sum[:8])+ext), nil
+}
+
+// readCache returns the branches cached for repo, or nil if there aren't any,
+// or they were cached with a different key. Any error reading the cache is
+// treated as a miss, since the branches can always be read again.
+func readCache(repo *git.Repository, key string) []Branch {
+	p, err := cachePath(repo, ".json")
+	if err != nil {
+		return nil
+	}
+
+	buf, err := os.ReadFile(p)
+	if err != nil {
+		return nil
+	}
+
+	var c branchCache
+	if err := json.Unmarshal(buf, &c); err != nil || c.Key != key {
+		return nil
+	}
+
+	branches := make([]Branch, len(c.Branches))
+	for i, cb := range c.Branches {
+		branches[i] = Branch{
+			Name:     cb.Name,
+			Hash:     plumbing.NewHash(cb.Hash),
+			Date:     cb.Date,
+			Author:   cb.Author,
+			Email:    cb.Email,
+			Subject:  cb.Subject,
+			IsHead:   cb.IsHead,
+			IsRemote: cb.IsRemote,
+			Local:    cb.Local,
+			HasLocal: cb.HasLocal,
+			Upstream: cb.Upstream,
+			Ahead:    cb.Ahead,
+			Behind:   cb.Behind,
+			Gone:     cb.Gone,
+			IsTag:    cb.IsTag,
+
+			Commits:    cb.Commits,
+			HasCommits: cb.HasCommits,
+		}
+	}
+
+	return branches
+}
+
+// writeCache caches branches for repo, to be read by readCache. Like reading,
+// it's best effort; errors are ignored, and the branches will just be read
+// from the repo again next time.
+func writeCache(repo *git.Repository, key string, branches []Branch) {
+	p, err := cachePath(repo, ".json")
+	if err != nil {
+		return
+	}
+
+	c := branchCache{Key: key, Branches: make([]cachedBranch, len(branches))}
+	for i, b := range branches {
+		c.Branches[i] = cachedBranch{
+			Name:     b.Name,
+			Hash:     b.Hash.String(),
+			Date:     b.Date,
+			Author:   b.Author,
+			Email:    b.Email,
+			Subject:  b.Subject,
+			IsHead:   b.IsHead,
+			IsRemote: b.IsRemote,
+			Local:    b.Local,
+			HasLocal: b.HasLocal,
+			Upstream: b.Upstream,
+			Ahead:    b.Ahead,
+			Behind:   b.Behind,
+			Gone:     b.Gone,
+			IsTag:    b.IsTag,
+
+			Commits:    b.Commits,
+			HasCommits: b.HasCommits,
+		}
+	}
+
+	buf, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return
+	}
+
+	// write to a temporary file first, so a concurrent run never reads half
+	// of the cache.
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0o644); err != nil {
+		return
+	}
+	os.Rename(tmp, p)
+}
+
+func getBranches(repo *git.Repository, opts Options) (*List, error) {
+	// in a new repo with no commits, HEAD points to a branch which doesn't
+	// exist yet. that's not an error; there are just no branches to list.
+	var headName plumbing.ReferenceName
+	headRef, err := repo.Head()
+	if err == nil {
+		headName = headRef.Name()
+	} else if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil, fmt.Errorf("repo.Head: %w", err)
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return nil, fmt.Errorf("repo.Config: %w", err)
+	}
+
+	// collect the refs first, so their commits can be looked up concurrently.
+	refs := []branchRef{}
+
+	iter, err := repo.Branches()
+	if err != nil {
+		return nil, fmt.Errorf("repo.Branches: %w", err)
+	}
+
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		refs = append(refs, branchRef{ref: ref})
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("iter.ForEach: %w", err)
+	}
+
+	if opts.Remote {
+		iter, err := repo.References()
+		if err != nil {
+			return nil, fmt.Errorf("repo.References: %w", err)
+		}
+
+		err = iter.ForEach(func(ref *plumbing.Reference) error {
+			// skip symbolic refs like origin/HEAD, which just point to
+			// another remote branch.
+			if !ref.Name().IsRemote() || ref.Type() != plumbing.HashReference {
+				return nil
+			}
+
+			refs = append(refs, branchRef{ref: ref, isRemote: true})
+			return nil
+		})
+
+		if err != nil {
+			return nil, fmt.Errorf("refs.ForEach: %w", err)
+		}
+	}
+
+	// tags pointing to missing objects are skipped like branches, below.
+	var skippedTags []branchRef
+	if opts.Tags {
+		iter, err := repo.Tags()
+		if err != nil {
+			return nil, fmt.Errorf("repo.Tags: %w", err)
+		}
+
+		err = iter.ForEach(func(ref *plumbing.Reference) error {
+			hash, ok, err := tagCommit(repo, ref)
+			if errors.Is(err, plumbing.ErrObjectNotFound) {
+				skippedTags = append(skippedTags, branchRef{ref: ref, isTag: true})
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", ref.Name().Short(), err)
+			}
+			if !ok {
+				return nil
+			}
+
+			ref = plumbing.NewHashReference(ref.Name(), hash)
+			refs = append(refs, branchRef{ref: ref, isTag: true})
+			return nil
+		})
+
+		if err != nil {
+			return nil, fmt.Errorf("tags.ForEach: %w", err)
+		}
+	}
+
+	// the names of local branches, so we know which remote branches already
+	// have a local branch tracking them.
+	locals := map[string]bool{}
+	for _, br := range refs {
+		if !br.isRemote && !br.isTag {
+			locals[br.ref.Name().Short()] = true
+		}
+	}
+
+	// with -commits, count the commits on each branch which aren't on the
+	// default branch.
+	var base *plumbing.Reference
+	if opts.countCommits() {
+		base, err = defaultBranch(repo, opts.Base)
+		if err != nil {
+			return nil, fmt.Errorf("defaultBranch: %w", err)
+		}
+	}
+
+	// only a missing commit skips the branch. the commit counts are extra, so
+	// if they can't be worked out, just leave those columns blank.
+	load := func(repo *git.Repository, br branchRef) (Branch, error) {
+		ref := br.ref
+		branchName := ref.Name().Short()
+
+		commit, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			return Branch{}, fmt.Errorf("repo.CommitObject: %w", err)
+		}
+
+		subject, _, _ := strings.Cut(commit.Message, "\n")
+		subject = sanitize(subject)
+		// when HEAD is detached, its name is just HEAD, so this is false for
+		// every branch.
+		isHead := ref.Name() == headName
+
+		b := Branch{
+			Name:     branchName,
+			Hash:     ref.Hash(),
+			Date:     commit.Committer.When,
+			Author:   sanitize(commit.Author.Name),
+			Email:    sanitize(commit.Author.Email),
+			Subject:  subject,
+			IsHead:   isHead,
+			IsRemote: br.isRemote,
+			IsTag:    br.isTag,
+		}
+
+		if base != nil {
+			b.Commits, _, err = divergence(repo, ref.Hash(), base.Hash())
+			b.HasCommits = err == nil
+		}
+
+		if br.isRemote {
+			_, b.Local, _ = strings.Cut(branchName, "/")
+			b.HasLocal = locals[b.Local]
+		} else if !br.isTag {
+			// compare to the upstream, if there is one, and it still exists.
+			upName, upRef, err := upstream(repo, cfg, branchName)
+			if err == nil && upName != "" && upRef == nil {
+				b.Upstream = upName.Short()
+				b.Gone = true
+			}
+			if err == nil && upRef != nil {
+				b.Ahead, b.Behind, err = divergence(repo, ref.Hash(), upRef.Hash())
+				if err == nil {
+					b.Upstream = upRef.Name().Short()
+				}
+			}
+		}
+
+		return b, nil
+	}
+
+	// with -cache, reuse the branches from last time if no refs have changed
+	// since, rather than looking up every commit again.
+	var branches []Branch
+	var key string
+	if opts.Cache {
+		key, err = cacheKey(repo, cfg, opts, base)
+		if err != nil {
+			return nil, fmt.Errorf("cacheKey: %w", err)
+		}
+		branches = readCache(repo, key)
+	}
+
+	skipped := skippedTags
+	if branches == nil {
+		var unread []branchRef
+		branches, unread, err = loadBranches(repo, refs, load)
+		if err != nil {
+			return nil, err
+		}
+		skipped = append(unread, skipped...)
+
+		// don't cache the broken refs away, so the warning is shown until
+		// they're fixed.
+		if opts.Cache && len(skipped) == 0 {
+			writeCache(repo, key, branches)
+		}
+	}
+
+	// mark the branches which are checked out in other worktrees. this isn't
+	// cached, since the cache key doesn't cover worktrees.
+	worktrees, err := otherWorktrees(repo)
+	if err != nil {
+		return nil, fmt.Errorf("otherWorktrees: %w", err)
+	}
+	for i := range branches {
+		if b := &branches[i]; !b.IsRemote && !b.IsTag && !b.IsHead {
+			b.Worktree = worktrees[b.Name]
+		}
+	}
+
+	if opts.Pattern != "" {
+		// check the pattern up front, so a typo isn't mistaken for a pattern
+		// which doesn't match anything.
+		if _, err := path.Match(opts.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", opts.Pattern, err)
+		}
+
+		branches = slices.DeleteFunc(branches, func(b Branch) bool {
+			ok, _ := path.Match(opts.Pattern, b.Name)
+			return !ok
+		})
+	}
+
+	if opts.Regex != nil {
+		branches = slices.DeleteFunc(branches, func(b Branch) bool {
+			return !opts.Regex.MatchString(b.Name)
+		})
+	}
+
+	if opts.AuthoredBy != nil {
+		branches = slices.DeleteFunc(branches, func(b Branch) bool {
+			return !opts.AuthoredBy.MatchString(b.Author) && !opts.AuthoredBy.MatchString(b.Email)
+		})
+	}
+
+	now := time.Now()
+	if opts.Since != 0 {
+		branches = slices.DeleteFunc(branches, func(b Branch) bool {
+			return b.Date.Before(now.Add(-opts.Since))
+		})
+	}
+	if opts.Before != 0 {
+		branches = slices.DeleteFunc(branches, func(b Branch) bool {
+			return b.Date.After(now.Add(-opts.Before))
+		})
+	}
+
+	if opts.NoCurrent {
+		branches = slices.DeleteFunc(branches, func(b Branch) bool {
+			return b.IsHead
+		})
+	}
+
+	// with -merged or -no-merged, keep only the branches which have (or
+	// haven't) been merged into the base.
+	for _, f := range []struct {
+		flag, rev string
+		merged    bool
+	}{
+		{"-merged", opts.Merged, true},
+		{"-no-merged", opts.NoMerged, false},
+	} {
+		if f.rev == "" {
+			continue
+		}
+
+		var base *plumbing.Hash
+		if f.rev == BaseBranch {
+			ref, err := defaultBranch(repo, opts.Base)
+			if err != nil {
+				return nil, fmt.Errorf("defaultBranch: %w", err)
+			}
+			if ref == nil {
+				return nil, fmt.Errorf("%s: no base branch; use -base to choose one", f.flag)
+			}
+			h := ref.Hash()
+			base = &h
+		} else {
+			base, err = repo.ResolveRevision(plumbing.Revision(f.rev))
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q: %w", f.flag, f.rev, err)
+			}
+		}
+
+		branches, err = filterBranches(branches, func(b Branch) (bool, error) {
+			merged, err := isAncestor(repo, b.Hash, *base)
+			return merged == f.merged, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("filterBranches: %w", err)
+		}
+	}
+
+	// with -contains, keep only the branches which include the commit.
+	if opts.Contains != "" {
+		commit, err := repo.ResolveRevision(plumbing.Revision(opts.Contains))
+		if err != nil {
+			return nil, fmt.Errorf("invalid -contains %q: %w", opts.Contains, err)
+		}
+
+		branches, err = filterBranches(branches, func(b Branch) (bool, error) {
+			return isAncestor(repo, *commit, b.Hash)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("filterBranches: %w", err)
+		}
+	}
+
+	var recent map[string]int
+	if opts.Sort == "recent" {
+		recent, err = recentCheckouts(repo)
+		if err != nil {
+			return nil, fmt.Errorf("recentCheckouts: %w", err)
+		}
+	}
+
+	err = sortBranches(branches, opts.Sort, recent)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Reverse {
+		slices.Reverse(branches)
+	}
+
+	// only show the first n, at least until the user scrolls past them. zero
+	// (or less) means all of them.
+	l := NewList(branches)
+	l.repoName = repoName(repo)
+	if opts.Count > 0 {
+		l.limit = opts.Count
+	}
+	l.group = opts.Group
+	l.sort = opts.Sort
+	if l.sort == "" {
+		l.sort = "date"
+	}
+	switch opts.Match {
+	case "", "fuzzy":
+	case "substring":
+		l.substring = true
+	default:
+		return nil, fmt.Errorf("invalid match: %q (want fuzzy or substring)", opts.Match)
+	}
+	l.detached = headName != "" && !headName.IsBranch()
+	l.setFilter("")
+	if len(skipped) > 0 {
+		l.message = skippedMessage(skipped)
+	}
+
+	return l, nil
+}
+
+// sanitize replaces any non-printable characters in s (like a stray carriage
+// return) with spaces, so they can't corrupt the display.
+func sanitize(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if !unicode.IsPrint(r) {
+			return ' '
+		}
+		return r
+	}, s)
+
+	return strings.TrimSpace(s)
+}
+
+// sortModes are the sorts which s cycles through in the prompt.
+var sortModes = []string{"date", "name", "recent"}
+
+// nextSort returns the sort after mode in sortModes, or the first if mode isn't
+// one of them.
+func nextSort(mode string) string {
+	if mode == "" {
+		mode = "date"
+	}
+
+	i := slices.Index(sortModes, mode)
+	return sortModes[(i+1)%len(sortModes)]
+}
+
+// sortBranches sorts the given branches in place, by the given mode: date
+// (newest first), recent (most recently checked out first, using the ranks in
+// recent), name, or name-desc.
+func sortBranches(branches []Branch, mode string, recent map[string]int) error {
+	var less func(a, b *Branch) bool
+
+	byDate := func(a, b *Branch) bool {
+		// fall back to the name when the dates are equal (e.g. after a
+		// scripted rebase), so the order is the same every run.
+		if a.Date.Equal(b.Date) {
+			return a.Name < b.Name
+		}
+		return a.Date.After(b.Date)
+	}
+
+	// ignore case, but fall back to it for names which only differ by case.
+	byName := func(a, b *Branch) bool {
+		la, lb := strings.ToLower(a.Name), strings.ToLower(b.Name)
+		if la == lb {
+			return a.Name < b.Name
+		}
+		return la < lb
+	}
+
+	switch mode {
+	case "", "date":
+		less = byDate
+	case "recent":
+		less = func(a, b *Branch) bool {
+			// branches which were never checked out go after those which
+			// were, by date.
+			ra, okA := recent[a.Name]
+			rb, okB := recent[b.Name]
+			if okA && okB {
+				return ra < rb
+			}
+			if okA != okB {
+				return okA
+			}
+			return byDate(a, b)
+		}
+	case "name":
+		less = byName
+	case "name-desc":
+		less = func(a, b *Branch) bool {
+			return byName(b, a)
+		}
+	default:
+		return fmt.Errorf("invalid sort: %q (want date, recent, name, or name-desc)", mode)
+	}
+
+	// stable, so branches which are still equal, like a branch and a tag with
+	// the same name, stay in the order they were listed.
+	sort.SliceStable(branches, func(i, j int) bool {
+		return less(&branches[i], &branches[j])
+	})
+
+	return nil
+}
+
+// recentCheckouts reads HEAD's reflog, and returns the names of the branches
+// which have been checked out, ranked from most recently (zero) to least.
+func recentCheckouts(repo *git.Repository) (map[string]int, error) {
+	s, ok := repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil, fmt.Errorf("unsupported storage: %T", repo.Storer)
+	}
+
+	f, err := s.Filesystem().Open(s.Filesystem().Join("logs", "HEAD"))
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]int{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Open: %w", err)
+	}
+	defer f.Close()
+
+	// each line is like "<old> <new> <who> <when>\tcheckout: moving from a
+	// to b", oldest first.
+	var moves [][2]string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		_, msg, ok := strings.Cut(sc.Text(), "\t")
+		if !ok {
+			continue
+		}
+		rest, ok := strings.CutPrefix(msg, "checkout: moving from ")
+		if !ok {
+			continue
+		}
+		from, to, ok := strings.Cut(rest, " to ")
+		if !ok {
+			continue
+		}
+		moves = append(moves, [2]string{from, to})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("Scan: %w", err)
+	}
+
+	// walk backwards, so the branch checked out last is ranked first. the
+	// branch which was moved away from was checked out until then, so it
+	// comes next.
+	ranks := map[string]int{}
+	for i := len(moves) - 1; i >= 0; i-- {
+		for _, name := range []string{moves[i][1], moves[i][0]} {
+			if _, ok := ranks[name]; !ok {
+				ranks[name] = len(ranks)
+			}
+		}
+	}
+
+	return ranks, nil
+}
+
+// repoName returns the name of the directory containing the repo's worktree,
+// or the current directory if it doesn't have one.
+func repoName(repo *git.Repository) string {
+	if wt, err := repo.Worktree(); err == nil {
+		if root, err := filepath.Abs(wt.Filesystem.Root()); err == nil {
+			return filepath.Base(root)
+		}
+	}
+
+	wd, _ := os.Getwd()
+	return filepath.Base(wd)
+}
+
+// tagCommit returns the commit which the given tag points to, which is another
+// object for annotated tags. Returns false if it doesn't point to a commit.
+func tagCommit(repo *git.Repository, ref *plumbing.Reference) (plumbing.Hash, bool, error) {
+	tag, err := repo.TagObject(ref.Hash())
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		// a lightweight tag, which points straight to the commit. or at least
+		// to something; check that it's a commit.
+		_, err := repo.CommitObject(ref.Hash())
+		if errors.Is(err, plumbing.ErrObjectNotFound) || errors.Is(err, object.ErrUnsupportedObject) {
+			return plumbing.ZeroHash, false, nil
+		}
+		if err != nil {
+			return plumbing.ZeroHash, false, fmt.Errorf("repo.CommitObject: %w", err)
+		}
+		return ref.Hash(), true, nil
+	}
+	if err != nil {
+		return plumbing.ZeroHash, false, fmt.Errorf("repo.TagObject: %w", err)
+	}
+
+	commit, err := tag.Commit()
+	if errors.Is(err, object.ErrUnsupportedObject) {
+		return plumbing.ZeroHash, false, nil
+	}
+	if err != nil {
+		return plumbing.ZeroHash, false, fmt.Errorf("tag.Commit: %w", err)
+	}
+
+	return commit.Hash, true, nil
+}
+
+// otherWorktrees returns the branches which are checked out in the worktrees of
+// repo, keyed by name, with the path of the worktree. This includes the one
+// which repo was opened in, but HEAD says which that is.
+func otherWorktrees(repo *git.Repository) (map[string]string, error) {
+	s, ok := repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil, nil
+	}
+	fs := s.Filesystem()
+	worktrees := map[string]string{}
+
+	// linked worktrees each have a directory in the main git dir, containing
+	// their HEAD, and the path to their .git file.
+	dirs, err := fs.ReadDir("worktrees")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("fs.ReadDir: %w", err)
+	}
+	for _, d := range dirs {
+		head, err := readFile(fs, fs.Join("worktrees", d.Name(), "HEAD"))
+		if err != nil {
+			continue
+		}
+		gitdir, err := readFile(fs, fs.Join("worktrees", d.Name(), "gitdir"))
+		if err != nil {
+			continue
+		}
+		if name, ok := headBranch(head); ok {
+			worktrees[name] = filepath.Dir(gitdir)
+		}
+	}
+
+	// if repo is a linked worktree, the main worktree is elsewhere. the git
+	// dir names it.
+	common, err := readFile(fs, "commondir")
+	if err != nil {
+		return worktrees, nil
+	}
+	if !filepath.IsAbs(common) {
+		common = filepath.Join(fs.Root(), common)
+	}
+	head, err := os.ReadFile(filepath.Join(common, "HEAD"))
+	if err != nil {
+		return worktrees, nil
+	}
+	if name, ok := headBranch(strings.TrimSpace(string(head))); ok {
+		worktrees[name] = filepath.Dir(filepath.Clean(common))
+	}
+
+	return worktrees, nil
+}
+
+// readFile returns the contents of the named file in fs, without surrounding
+// whitespace.
+func readFile(fs billy.Filesystem, name string) (string, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	buf, err := io.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(buf)), nil
+}
+
+// headBranch returns the name of the branch which the contents of a HEAD file
+// point to. Returns false if it's detached.
+func headBranch(head string) (string, bool) {
+	ref, ok := strings.CutPrefix(head, "ref: ")
+	if !ok {
+		return "", false
+	}
+
+	name := plumbing.ReferenceName(ref)
+	return name.Short(), name.IsBranch()
+}
+
+// readLast returns the name of the branch which was chosen last time in repo,
+// as saved by writeLast, or an empty string if there wasn't one.
+func readLast(repo *git.Repository) string {
+	p, err := cachePath(repo, ".last")
+	if err != nil {
+		return ""
+	}
+
+	buf, err := os.ReadFile(p)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(buf))
+}
+
+// writeLast saves the name of the branch which was chosen in repo, so it can be
+// selected to begin with next time. Like the cache, it's best effort.
+func writeLast(repo *git.Repository, name string) {
+	p, err := cachePath(repo, ".last")
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return
+	}
+	os.WriteFile(p, []byte(name+"\n"), 0o644)
+}
+
+// upstream returns the name of the ref which the named local branch is
+// configured to track, and the ref itself. The name is empty if there isn't one,
+// and the ref is nil if it doesn't exist; git calls that upstream "gone".
+func upstream(repo *git.Repository, cfg *config.Config, name string) (plumbing.ReferenceName, *plumbing.Reference, error) {
+	bc, ok := cfg.Branches[name]
+	if !ok || bc.Remote == "" || bc.Merge == "" {
+		return "", nil, nil
+	}
+
+	// a remote of "." means that the upstream is another local branch.
+	refName := bc.Merge
+	if bc.Remote != "." {
+		refName = plumbing.NewRemoteReferenceName(bc.Remote, bc.Merge.Short())
+	}
+
+	ref, err := repo.Reference(refName, true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return refName, nil, nil
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("repo.Reference: %w", err)
+	}
+
+	return refName, ref, nil
+}
+
+// isAncestor returns true if a is reachable from b, i.e. if a has been merged
+// into b.
+func isAncestor(repo *git.Repository, a, b plumbing.Hash) (bool, error) {
+	ahead, _, err := divergence(repo, a, b)
+	if err != nil {
+		return false, err
+	}
+
+	return ahead == 0, nil
+}
+
+// filterBranches returns the branches for which keep returns true. Unlike
+// slices.DeleteFunc, keep can fail.
+func filterBranches(branches []Branch, keep func(Branch) (bool, error)) ([]Branch, error) {
+	out := branches[:0]
+	for _, b := range branches {
+		ok, err := keep(b)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, b)
+		}
+	}
+
+	return out, nil
+}
+
+// skippedMessage returns a warning about the branches and tags which couldn't be
+// loaded.
+func skippedMessage(skipped []branchRef) string {
+	var names []string
+	tags := 0
+	for _, br := range skipped {
+		names = append(names, br.ref.Name().Short())
+		if br.isTag {
+			tags++
+		}
+	}
+
+	var counts []string
+	if n := len(skipped) - tags; n == 1 {
+		counts = append(counts, "1 branch")
+	} else if n > 1 {
+		counts = append(counts, fmt.Sprintf("%d branches", n))
+	}
+	if tags == 1 {
+		counts = append(counts, "1 tag")
+	} else if tags > 1 {
+		counts = append(counts, fmt.Sprintf("%d tags", tags))
+	}
+
+	return fmt.Sprintf("skipped %s which couldn't be read: %s", strings.Join(counts, " and "), strings.Join(names, ", "))
+}
+
+// BaseBranch can be given as Merged or NoMerged to mean the base branch; see
+// Options.Base.
+const BaseBranch = "@{base}"
+
+// defaultBranch returns the branch which others are usually based on, and
+// merged into: the given one, if any, or the one which origin/HEAD points to,
+// or otherwise main or master, if either exists. Returns nil if none of them
+// do, unless one was given.
+func defaultBranch(repo *git.Repository, name string) (*plumbing.Reference, error) {
+	if name != "" {
+		names := []plumbing.ReferenceName{plumbing.NewBranchReferenceName(name)}
+		if remote, branch, ok := strings.Cut(name, "/"); ok {
+			names = append(names, plumbing.NewRemoteReferenceName(remote, branch))
+		}
+		for _, n := range names {
+			ref, err := repo.Reference(n, true)
+			if err == nil {
+				return ref, nil
+			}
+			if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+				return nil, fmt.Errorf("repo.Reference: %w", err)
+			}
+		}
+
+		// it could be any other revision, like a tag.
+		hash, err := repo.ResolveRevision(plumbing.Revision(name))
+		if err != nil {
+			return nil, fmt.Errorf("invalid -base %q: %w", name, err)
+		}
+		return plumbing.NewHashReference(plumbing.ReferenceName(name), *hash), nil
+	}
+
+	names := []plumbing.ReferenceName{
+		plumbing.NewRemoteHEADReferenceName("origin"),
+		plumbing.NewBranchReferenceName("main"),
+		plumbing.NewBranchReferenceName("master"),
+	}
+
+	for _, name := range names {
+		ref, err := repo.Reference(name, true)
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("repo.Reference: %w", err)
+		}
+		return ref, nil
+	}
+
+	return nil, nil
+}
+
+// divergence returns the number of commits which are reachable from a but not
+// from b, and vice versa. Rather than walking the whole history of both, this
+// walks backwards from both in date order, and stops once every commit left to
+// visit is reachable from both, plus a few more, like git, in case commit dates
+// are skewed.
+func divergence(repo *git.Repository, a, b plumbing.Hash) (int, int, error) {
+	if a == b {
+		return 0, 0, nil
+	}
+
+	const (
+		fromA = 1 << iota
+		fromB
+		fromBoth = fromA | fromB
+	)
+
+	flags := map[plumbing.Hash]int{}
+	queued := map[plumbing.Hash]bool{}
+	q := &commitQueue{}
+
+	// revisit is the set of queued commits which were already visited before
+	// they were found to be reachable from the other side too, so their
+	// ancestors need updating. this happens when commit dates are skewed, and
+	// a parent is newer than its child.
+	revisit := map[plumbing.Hash]bool{}
+
+	// the number of queued commits which aren't yet known to be reachable
+	// from both, or need revisiting. when this reaches zero, we're almost done.
+	active := 0
+	isActive := func(h plumbing.Hash) bool {
+		return queued[h] && (flags[h] != fromBoth || revisit[h])
+	}
+
+	mark := func(c *object.Commit, f int) {
+		old := flags[c.Hash]
+		if old|f == old {
+			return
+		}
+
+		was := isActive(c.Hash)
+		flags[c.Hash] = old | f
+
+		if !queued[c.Hash] {
+			queued[c.Hash] = true
+			heap.Push(q, c)
+			if old != 0 {
+				revisit[c.Hash] = true
+			}
+		}
+
+		if now := isActive(c.Hash); now && !was {
+			active++
+		} else if was && !now {
+			active--
+		}
+	}
+
+	for h, f := range map[plumbing.Hash]int{a: fromA, b: fromB} {
+		c, err := repo.CommitObject(h)
+		if err != nil {
+			return 0, 0, fmt.Errorf("repo.CommitObject: %w", err)
+		}
+		mark(c, f)
+	}
+
+	// once nothing is active, keep walking a few commits which are reachable
+	// from both, since with skewed dates, one of them can reach a commit which
+	// was already visited from only one side.
+	const slop = 5
+	extra := slop
+	for q.Len() > 0 {
+		if active > 0 {
+			extra = slop
+		} else if extra == 0 {
+			break
+		} else {
+			extra--
+		}
+
+		c := heap.Pop(q).(*object.Commit)
+		if isActive(c.Hash) {
+			active--
+		}
+		queued[c.Hash] = false
+		delete(revisit, c.Hash)
+		f := flags[c.Hash]
+
+		for _, h := range c.ParentHashes {
+			p, err := repo.CommitObject(h)
+			if err != nil {
+				return 0, 0, fmt.Errorf("repo.CommitObject: %w", err)
+			}
+			mark(p, f)
+		}
+	}
+
+	ahead, behind := 0, 0
+	for _, f := range flags {
+		switch f {
+		case fromA:
+			ahead++
+		case fromB:
+			behind++
+		}
+	}
+
+	return ahead, behind, nil
+}
+
+// commitQueue is a heap of commits, newest first.
+type commitQueue []*object.Commit
+
+func (q commitQueue) Len() int           { return len(q) }
+func (q commitQueue) Less(i, j int) bool { return q[i].Committer.When.After(q[j].Committer.When) }
+func (q commitQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *commitQueue) Push(x any)        { *q = append(*q, x.(*object.Commit)) }
+
+func (q *commitQueue) Pop() any {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,237 @@
+package selector
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// testRepo is an in-memory repo, for building commit graphs to test against.
+type testRepo struct {
+	t    *testing.T
+	repo *git.Repository
+	tree plumbing.Hash
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	repo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		t.Fatalf("git.Init: %s", err)
+	}
+
+	r := &testRepo{t: t, repo: repo}
+	r.tree = r.store(&object.Tree{})
+	return r
+}
+
+// store writes the given object to the repo, and returns its hash.
+func (r *testRepo) store(o interface {
+	Encode(plumbing.EncodedObject) error
+}) plumbing.Hash {
+	obj := r.repo.Storer.NewEncodedObject()
+	if err := o.Encode(obj); err != nil {
+		r.t.Fatalf("Encode: %s", err)
+	}
+
+	h, err := r.repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		r.t.Fatalf("SetEncodedObject: %s", err)
+	}
+
+	return h
+}
+
+// commit writes a commit with the given message, dated the given number of
+// minutes after an arbitrary epoch, with the given parents.
+func (r *testRepo) commit(msg string, minutes int, parents ...plumbing.Hash) plumbing.Hash {
+	sig := object.Signature{
+		Name:  "test",
+		Email: "test@example.com",
+		When:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(minutes) * time.Minute),
+	}
+
+	return r.store(&object.Commit{
+		Author:       sig,
+		Committer:    sig,
+		Message:      msg,
+		TreeHash:     r.tree,
+		ParentHashes: parents,
+	})
+}
+
+func TestDivergence(t *testing.T) {
+	r := newTestRepo(t)
+
+	// a linear history: base, then main on top.
+	base := r.commit("base", 0)
+	main1 := r.commit("main 1", 10, base)
+	main2 := r.commit("main 2", 20, main1)
+
+	// a branch from base, and a merge of it into main.
+	feat := r.commit("feature", 15, base)
+	merge := r.commit("merge", 30, main2, feat)
+
+	// commits whose dates are skewed, so a parent is newer than its child,
+	// like after a rebase or with a bad clock. the walk goes in date order,
+	// but the counts shouldn't depend on it.
+	old := r.commit("old", 1)
+	shared := r.commit("shared", 50, old)
+	left := r.commit("left", 300, shared)
+	skewed := r.commit("skewed", 5, shared)
+	right := r.commit("right", 100, skewed)
+
+	// a merge of a commit which is older than its parent. by the time the walk
+	// finds that queued is reachable from both, it has already visited fork
+	// from the merge, and has to go back to mark it reachable from both too.
+	fork := r.commit("fork", 100)
+	queued := r.commit("queued", 50, fork)
+	forkMerge := r.commit("fork merge", 200, fork, queued)
+	onQueued := r.commit("on queued", 60, queued)
+
+	tests := []struct {
+		name          string
+		a, b          plumbing.Hash
+		ahead, behind int
+	}{
+		{"same", main2, main2, 0, 0},
+		{"ahead", main2, base, 2, 0},
+		{"behind", base, main2, 0, 2},
+		{"diverged", feat, main2, 1, 2},
+		{"merged", feat, merge, 0, 3},
+		{"merge", merge, feat, 3, 0},
+		{"unrelated", main1, old, 2, 1},
+		{"skewed", left, right, 1, 2},
+		{"skewed reversed", right, left, 2, 1},
+		{"skewed ancestor", skewed, right, 0, 1},
+		{"skewed merge", forkMerge, onQueued, 1, 1},
+		{"skewed merge reversed", onQueued, forkMerge, 1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ahead, behind, err := divergence(r.repo, tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("divergence: %s", err)
+			}
+			if ahead != tt.ahead || behind != tt.behind {
+				t.Errorf("divergence() = %d, %d, want %d, %d", ahead, behind, tt.ahead, tt.behind)
+			}
+		})
+	}
+}
+
+func TestIsAncestor(t *testing.T) {
+	r := newTestRepo(t)
+
+	base := r.commit("base", 0)
+	main := r.commit("main", 10, base)
+	feat := r.commit("feature", 15, base)
+	merge := r.commit("merge", 30, main, feat)
+
+	// dated before the commit it's based on, so the walk visits main and base
+	// before finding main from skewed, and has to go back to mark base as
+	// reachable from both. this used to stop too early.
+	skewed := r.commit("skewed", -10, main)
+	tip := r.commit("tip", 40, skewed)
+
+	tests := []struct {
+		name string
+		a, b plumbing.Hash
+		want bool
+	}{
+		{"itself", main, main, true},
+		{"parent", base, main, true},
+		{"child", main, base, false},
+		{"sibling", feat, main, false},
+		{"merged", feat, merge, true},
+		{"skewed", main, tip, true},
+		{"skewed base", base, tip, true},
+		{"not merged", feat, tip, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := isAncestor(r.repo, tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("isAncestor: %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("isAncestor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkippedMessage(t *testing.T) {
+	branch := func(name string) branchRef {
+		return branchRef{ref: plumbing.NewHashReference(plumbing.NewBranchReferenceName(name), plumbing.ZeroHash)}
+	}
+	tag := func(name string) branchRef {
+		return branchRef{ref: plumbing.NewHashReference(plumbing.NewTagReferenceName(name), plumbing.ZeroHash), isTag: true}
+	}
+
+	tests := []struct {
+		skipped []branchRef
+		want    string
+	}{
+		{[]branchRef{branch("main")}, "skipped 1 branch which couldn't be read: main"},
+		{[]branchRef{branch("a"), branch("b")}, "skipped 2 branches which couldn't be read: a, b"},
+		{[]branchRef{tag("v1.0")}, "skipped 1 tag which couldn't be read: v1.0"},
+		{[]branchRef{branch("a"), tag("v1.0"), tag("v2.0")}, "skipped 1 branch and 2 tags which couldn't be read: a, v1.0, v2.0"},
+	}
+
+	for _, tt := range tests {
+		if got := skippedMessage(tt.skipped); got != tt.want {
+			t.Errorf("skippedMessage() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestSortBranches(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	input := []Branch{
+		{Name: "b", Date: now},
+		{Name: "Main", Date: now.Add(-time.Hour)},
+		{Name: "main", Date: now.Add(-time.Hour)},
+		{Name: "a", Date: now},
+		{Name: "v1", Date: now.Add(-2 * time.Hour), IsTag: true},
+		{Name: "v1", Date: now.Add(-2 * time.Hour)},
+	}
+
+	tests := []struct {
+		mode string
+		want []string
+	}{
+		{"date", []string{"a", "b", "Main", "main", "v1", "v1"}},
+		{"name", []string{"a", "b", "Main", "main", "v1", "v1"}},
+		{"name-desc", []string{"v1", "v1", "main", "Main", "b", "a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			branches := slices.Clone(input)
+			if err := sortBranches(branches, tt.mode, nil); err != nil {
+				t.Fatalf("sortBranches: %s", err)
+			}
+
+			var got []string
+			for _, b := range branches {
+				got = append(got, b.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("sortBranches(%q) = %v, want %v", tt.mode, got, tt.want)
+			}
+
+			// the tag and the branch named v1 are equal either way, so they
+			// stay in the order they were given.
+			if i := slices.IndexFunc(branches, func(b Branch) bool { return b.Name == "v1" }); !branches[i].IsTag {
+				t.Errorf("sortBranches(%q) moved the branch v1 before the tag", tt.mode)
+			}
+		})
+	}
+}
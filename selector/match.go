@@ -0,0 +1,113 @@
+package selector
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// match returns the parts of name which match the filter, and a score to rank
+// it by, where higher is better. Returns false if it doesn't match.
+func (l *List) match(name string) ([]span, int, bool) {
+	if l.substring {
+		spans, ok := matchSubstring(name, l.filter)
+		return spans, 0, ok
+	}
+
+	return matchFuzzy(name, l.filter)
+}
+
+// span is the byte offsets of part of a string, from start up to end.
+type span struct {
+	start, end int
+}
+
+// matchSubstring returns the first part of s which matches the filter,
+// ignoring case.
+func matchSubstring(s, filter string) ([]span, bool) {
+	for i := range s {
+		if end := i + len(filter); end <= len(s) && strings.EqualFold(s[i:end], filter) {
+			return []span{{i, end}}, true
+		}
+	}
+
+	return nil, false
+}
+
+// matchFuzzy returns the parts of s which match the characters of the filter,
+// in order, ignoring case, like fzf. So "flgn" matches "feature/login". If
+// there's more than one way to match, it returns the best, according to
+// fuzzyScore, along with the score.
+func matchFuzzy(s, filter string) ([]span, int, bool) {
+	pattern := []rune(strings.ToLower(filter))
+	if len(pattern) == 0 {
+		return nil, 0, true
+	}
+
+	// the offset of each rune in s, so matches can be turned back into spans.
+	var runes []rune
+	var offsets []int
+	for i, r := range s {
+		runes = append(runes, unicode.ToLower(r))
+		offsets = append(offsets, i)
+	}
+
+	// try starting from each occurrence of the first character, and match
+	// the rest as early as possible after it.
+	var best []int
+	bestScore := 0
+	for start := range runes {
+		if runes[start] != pattern[0] {
+			continue
+		}
+
+		matched := []int{start}
+		for i := start + 1; i < len(runes) && len(matched) < len(pattern); i++ {
+			if runes[i] == pattern[len(matched)] {
+				matched = append(matched, i)
+			}
+		}
+		if len(matched) < len(pattern) {
+			break
+		}
+
+		if score := fuzzyScore(runes, matched); best == nil || score > bestScore {
+			best, bestScore = matched, score
+		}
+	}
+	if best == nil {
+		return nil, 0, false
+	}
+
+	// merge adjacent characters into one span.
+	var spans []span
+	for _, i := range best {
+		_, size := utf8.DecodeRuneInString(s[offsets[i]:])
+		if n := len(spans); n > 0 && spans[n-1].end == offsets[i] {
+			spans[n-1].end += size
+		} else {
+			spans = append(spans, span{offsets[i], offsets[i] + size})
+		}
+	}
+
+	return spans, bestScore, true
+}
+
+// fuzzyScore returns how good a match of the runes at the given indexes is.
+// Each character scores a point, with a bonus for following the previous one
+// directly, and for starting a word, so that "log" ranks feature/login above
+// feature/long-ago.
+func fuzzyScore(runes []rune, matched []int) int {
+	score := 0
+	for n, i := range matched {
+		score++
+		if n > 0 && matched[n-1] == i-1 {
+			score += 4
+		}
+		if i == 0 || strings.ContainsRune("/-_.", runes[i-1]) {
+			score += 2
+		}
+	}
+
+	return score
+}
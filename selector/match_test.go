@@ -0,0 +1,66 @@
+package selector
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMatchSubstring(t *testing.T) {
+	tests := []struct {
+		s, filter string
+		want      []span
+		wantOK    bool
+	}{
+		{"feature/login", "log", []span{{8, 11}}, true},
+		{"feature/login", "LOG", []span{{8, 11}}, true},
+		{"feature/login", "flgn", nil, false},
+		{"日本語/log", "log", []span{{10, 13}}, true},
+	}
+
+	for _, tt := range tests {
+		got, ok := matchSubstring(tt.s, tt.filter)
+		if !slices.Equal(got, tt.want) || ok != tt.wantOK {
+			t.Errorf("matchSubstring(%q, %q) = %v, %v, want %v, %v", tt.s, tt.filter, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestMatchFuzzy(t *testing.T) {
+	tests := []struct {
+		s, filter string
+		want      []span
+		wantOK    bool
+	}{
+		{"feature/login", "", nil, true},
+		{"feature/login", "flgn", []span{{0, 1}, {8, 9}, {10, 11}, {12, 13}}, true},
+		{"feature/login", "LOG", []span{{8, 11}}, true},
+		{"feature/login", "nl", nil, false},
+		{"feature/login", "x", nil, false},
+
+		// the later, contiguous, match is better than the first.
+		{"a-b-abc", "abc", []span{{4, 7}}, true},
+		{"日本語/log", "本g", []span{{3, 6}, {12, 13}}, true},
+	}
+
+	for _, tt := range tests {
+		got, _, ok := matchFuzzy(tt.s, tt.filter)
+		if !slices.Equal(got, tt.want) || ok != tt.wantOK {
+			t.Errorf("matchFuzzy(%q, %q) = %v, %v, want %v, %v", tt.s, tt.filter, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestMatchFuzzyRanking(t *testing.T) {
+	l := NewList(branches("feature/long-ago", "lots-of-gas", "feature/login"))
+	l.setFilter("log")
+
+	var got []string
+	for _, b := range l.branches {
+		got = append(got, b.Name)
+	}
+
+	want := []string{"feature/login", "lots-of-gas", "feature/long-ago"}
+	if !slices.Equal(got, want) {
+		t.Errorf("setFilter(%q) listed %v, want %v", "log", got, want)
+	}
+}
@@ -0,0 +1,98 @@
+package selector
+
+import (
+	"strconv"
+	"strings"
+)
+
+// the escape sequences which turn xterm mouse reporting on and off. 1000 reports
+// presses and releases, and 1006 reports them in SGR form, which isn't limited
+// to 223 rows and columns.
+const (
+	mouseOn  = "\x1b[?1000h\x1b[?1006h"
+	mouseOff = "\x1b[?1006l\x1b[?1000l"
+)
+
+// the buttons reported in mouse events.
+const (
+	mouseLeft      = 0
+	mouseWheelUp   = 64
+	mouseWheelDown = 65
+)
+
+// mouseEvent is a button being pressed or released, at a 1-based position on
+// the screen.
+type mouseEvent struct {
+	button int
+	x, y   int
+	press  bool
+}
+
+// parseMouse parses an SGR mouse report, like ESC [ < 0 ; 12 ; 5 M. Returns
+// false if buf isn't one.
+func parseMouse(buf []rune) (mouseEvent, bool) {
+	s := string(buf)
+	if !strings.HasPrefix(s, "\x1b[<") || len(s) < 4 {
+		return mouseEvent{}, false
+	}
+
+	final := s[len(s)-1]
+	if final != 'M' && final != 'm' {
+		return mouseEvent{}, false
+	}
+
+	n, ok := parseInts(s[3 : len(s)-1])
+	if !ok || len(n) != 3 {
+		return mouseEvent{}, false
+	}
+
+	return mouseEvent{button: n[0], x: n[1], y: n[2], press: final == 'M'}, true
+}
+
+// parseCursorPos parses the terminal's reply to a request for the cursor
+// position, like ESC [ 12 ; 1 R, and returns the 1-based row. Returns false if
+// buf isn't one.
+func parseCursorPos(buf []rune) (int, bool) {
+	s := string(buf)
+	if !strings.HasPrefix(s, "\x1b[") || !strings.HasSuffix(s, "R") || len(s) < 3 {
+		return 0, false
+	}
+
+	n, ok := parseInts(s[2 : len(s)-1])
+	if !ok || len(n) != 2 {
+		return 0, false
+	}
+
+	return n[0], true
+}
+
+// parseInts parses a list of integers separated by semicolons.
+func parseInts(s string) ([]int, bool) {
+	var n []int
+	for _, f := range strings.Split(s, ";") {
+		i, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, false
+		}
+		n = append(n, i)
+	}
+
+	return n, true
+}
+
+// rowAt returns the index in the list of the branch shown on the given row of
+// the screen, where top is the row of the first visible branch. Returns false if
+// there isn't a (selectable) branch there.
+func (l *List) rowAt(y, top int) (int, bool) {
+	i := y - top
+	if i < 0 || i >= len(l.visible()) {
+		return 0, false
+	}
+
+	idx := l.top + i
+	if l.branches[idx].isHeader {
+		return 0, false
+	}
+
+	return idx, true
+}
@@ -0,0 +1,70 @@
+package selector
+
+import "testing"
+
+func TestParseMouse(t *testing.T) {
+	tests := []struct {
+		buf    string
+		want   mouseEvent
+		wantOK bool
+	}{
+		{"\x1b[<0;12;5M", mouseEvent{button: mouseLeft, x: 12, y: 5, press: true}, true},
+		{"\x1b[<0;12;5m", mouseEvent{button: mouseLeft, x: 12, y: 5}, true},
+		{"\x1b[<64;1;1M", mouseEvent{button: mouseWheelUp, x: 1, y: 1, press: true}, true},
+		{"\x1b[<0;12M", mouseEvent{}, false},
+		{"\x1b[<a;1;1M", mouseEvent{}, false},
+		{"\x1b[A", mouseEvent{}, false},
+		{"q", mouseEvent{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseMouse([]rune(tt.buf))
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseMouse(%q) = %v, %v, want %v, %v", tt.buf, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestParseCursorPos(t *testing.T) {
+	tests := []struct {
+		buf    string
+		want   int
+		wantOK bool
+	}{
+		{"\x1b[12;1R", 12, true},
+		{"\x1b[1;80R", 1, true},
+		{"\x1b[12R", 0, false},
+		{"\x1b[A", 0, false},
+		{"R", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseCursorPos([]rune(tt.buf))
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseCursorPos(%q) = %d, %v, want %d, %v", tt.buf, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestListRowAt(t *testing.T) {
+	l := NewList(branches("a", "b", "c"))
+	l.height = 10
+
+	tests := []struct {
+		y      int
+		want   int
+		wantOK bool
+	}{
+		{4, 0, false},
+		{5, 0, true},
+		{7, 2, true},
+		{8, 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := l.rowAt(tt.y, 5)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("rowAt(%d, 5) = %d, %v, want %d, %v", tt.y, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
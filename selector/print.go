@@ -0,0 +1,655 @@
+package selector
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mattn/go-runewidth"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"golang.org/x/term"
+)
+
+// termSize returns the width and height of the terminal which w writes to, or
+// a typical size if it isn't one. COLUMNS and LINES override either, for when
+// the size can't be looked up, or is wrong.
+func termSize(w io.Writer) (int, int) {
+	width, height := 0, 0
+	if f, ok := w.(interface{ Fd() uintptr }); ok {
+		var err error
+		width, height, err = term.GetSize(int(f.Fd()))
+		if err != nil {
+			width, height = 0, 0
+		}
+	}
+
+	if n := envSize("COLUMNS"); n > 0 {
+		width = n
+	}
+	if n := envSize("LINES"); n > 0 {
+		height = n
+	}
+
+	// default
+	if width <= 0 {
+		width = 80
+	}
+	if height <= 0 {
+		height = 24
+	}
+
+	return width, height
+}
+
+// envSize returns the positive integer in the named environment variable, or
+// zero if it isn't set to one.
+func envSize(name string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(os.Getenv(name)))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// printBranches prints the visible part of the table of branches to w, with
+// each line truncated to width. Returns the number of lines printed.
+func printBranches(w io.Writer, list *List, opts Options, width int) int {
+	// build the contents of the table, unaligned. this includes the branches
+	// which are scrolled out of view, so the columns don't shift around.
+	// columns named explicitly are shown even if their flag isn't set.
+	columns := opts.Columns
+	explicit := len(columns) > 0
+	if !explicit {
+		columns = ColumnNames
+	}
+
+	var rows [][]string
+	for _, branch := range list.branches {
+		// headers aren't part of the table.
+		if branch.isHeader {
+			rows = append(rows, nil)
+			continue
+		}
+
+		hash := branch.shortHash()
+		if opts.NoHash && !explicit {
+			hash = ""
+		}
+
+		author := ""
+		if opts.Author || explicit {
+			author = branch.Author
+		}
+
+		up := ""
+		if (opts.Upstream || explicit) && !branch.IsRemote && !branch.IsTag {
+			up = "-"
+			if branch.Upstream != "" {
+				up = "→ " + branch.Upstream
+			}
+		}
+
+		tracking := branch.tracking()
+		if branch.IsTag {
+			tracking = "tag"
+		}
+		if branch.Worktree != "" {
+			tracking = strings.TrimSpace(tracking + " [in worktree]")
+		}
+
+		commits := ""
+		if branch.HasCommits {
+			commits = fmt.Sprintf("+%d", branch.Commits)
+		}
+
+		when := branch.when(opts.Date)
+		if branch.isStale(opts.Stale) {
+			when += " [stale]"
+		}
+
+		subject := branch.Subject
+		if opts.SubjectWidth > 0 {
+			subject = runewidth.Truncate(subject, opts.SubjectWidth, "…")
+		}
+
+		name := branch.displayName(opts.FullRef)
+		if opts.MaxNameWidth > 0 {
+			name = runewidth.Truncate(name, opts.MaxNameWidth, "…")
+		}
+
+		cells := map[string]string{
+			"name":     name,
+			"hash":     hash,
+			"upstream": up,
+			"tracking": tracking,
+			"commits":  commits,
+			"date":     when,
+			"author":   author,
+			"subject":  subject,
+		}
+
+		row := make([]string, len(columns))
+		for c, name := range columns {
+			row[c] = cells[name]
+		}
+		rows = append(rows, row)
+	}
+
+	// find the maximum width for each column
+	var cw []int
+	for _, row := range rows {
+		for c, col := range row {
+			if c >= len(cw) {
+				cw = append(cw, 0)
+			}
+			if n := runewidth.StringWidth(col); n > cw[c] {
+				cw[c] = n
+			}
+		}
+	}
+
+	// the name column is at least as wide as asked, even if every name is
+	// shorter.
+	if c := slices.Index(columns, "name"); c >= 0 && c < len(cw) {
+		cw[c] = max(cw[c], opts.MinNameWidth)
+	}
+
+	// label the first few visible branches with the number key which selects
+	// them.
+	keys := map[int]string{}
+	for n, i := range list.shortcuts() {
+		keys[i] = strconv.Itoa(n + 1)
+	}
+
+	// print the visible part of the table with aligned columns, leaving space
+	// for asterisk. columns which are empty in every row are left out.
+	for i, row := range rows[list.top : list.top+len(list.visible())] {
+		branch := &list.branches[list.top+i]
+
+		// headers aren't aligned with the other columns.
+		if branch.isHeader {
+			line := runewidth.Truncate(" "+branch.Name, width, "")
+			if opts.Color {
+				line = "\x1b[1m" + line + "\x1b[0m"
+			}
+			fmt.Fprintf(w, "%s\r\n", line)
+			continue
+		}
+
+		key := keys[list.top+i]
+		if key == "" {
+			key = " "
+		}
+
+		// join the cells, noting where the name is, so the part of it which
+		// matches the filter can be highlighted. it might not be first.
+		// with -head-marker, mark the branch which is checked out, which
+		// isn't always the selected one, even without color.
+		prefix := "   " + key + "  "
+		if opts.HeadMarker && branch.IsHead {
+			prefix += "• "
+		} else if opts.HeadMarker {
+			prefix += "  "
+		}
+
+		var b strings.Builder
+		b.WriteString(prefix)
+		nameAt, nameWidth, name := -1, 0, ""
+		for c, col := range row {
+			if cw[c] == 0 {
+				continue
+			}
+			if b.Len() > len(prefix) {
+				b.WriteString(opts.separator())
+			}
+			if columns[c] == "name" {
+				nameAt, nameWidth, name = b.Len(), cw[c], col
+			}
+			b.WriteString(runewidth.FillRight(col, cw[c]))
+		}
+
+		// if the terminal is too narrow for the longest name, after the number
+		// and whichever columns come before it, show just the names, with room
+		// for the markers printed by printSelected.
+		line := b.String()
+		if nameAt >= 0 && runewidth.StringWidth(line[:nameAt])+nameWidth > width {
+			line = "   " + name
+			nameAt = 3
+		}
+
+		// truncate by display width rather than bytes, so we don't cut a
+		// multi-byte rune in half, and count wide characters as two cells.
+		line = runewidth.Truncate(line, width, "")
+
+		// underline the part of the name which matches the filter, so it's
+		// clear why it's shown.
+		if opts.Color && list.filter != "" && nameAt >= 0 {
+			if spans, _, ok := list.match(branch.Name); ok {
+				// the spans are in the short name, which is at the end of
+				// the full one.
+				full := branch.displayName(opts.FullRef)
+				for i := range spans {
+					spans[i].start += len(full) - len(branch.Name)
+					spans[i].end += len(full) - len(branch.Name)
+				}
+				line = highlight(line, nameAt, clipSpans(spans, name, full))
+			}
+		}
+
+		// show the branch which is already checked out in green, tags in
+		// yellow, and dim any which are stale.
+		if opts.Color && branch.IsHead {
+			line = "\x1b[32m" + line + "\x1b[0m"
+		} else if opts.Color && branch.IsTag {
+			line = "\x1b[33m" + line + "\x1b[0m"
+		} else if opts.Color && branch.isStale(opts.Stale) {
+			line = "\x1b[2m" + line + "\x1b[0m"
+		}
+
+		// include carriage return, to move to column zero before moving down a
+		// row. this is necessary in raw mode.
+		fmt.Fprintf(w, "%s\r\n", line)
+	}
+
+	return len(list.visible())
+}
+
+// ColumnNames are the columns which can be shown, in the default order. Any
+// others in Options.Columns are left blank.
+var ColumnNames = []string{"name", "hash", "upstream", "tracking", "commits", "date", "author", "subject"}
+
+// clipSpans returns the parts of spans, which are offsets into name, which are
+// still there in shown, which is name truncated with an ellipsis (or not at all).
+func clipSpans(spans []span, shown, name string) []span {
+	if shown == name {
+		return spans
+	}
+
+	kept := len(strings.TrimSuffix(shown, "…"))
+	var out []span
+	for _, s := range spans {
+		if s.start < kept {
+			out = append(out, span{s.start, min(s.end, kept)})
+		}
+	}
+
+	return out
+}
+
+// highlight underlines the given spans of line, which are offset by the given
+// number of bytes, or as much of them as there is, if the line was truncated.
+func highlight(line string, offset int, spans []span) string {
+	// work backwards, so inserting escapes doesn't move the spans still to do.
+	for i := len(spans) - 1; i >= 0; i-- {
+		start, end := offset+spans[i].start, offset+spans[i].end
+		if start >= len(line) {
+			continue
+		}
+		end = min(end, len(line))
+		line = line[:start] + "\x1b[4m" + line[start:end] + "\x1b[24m" + line[end:]
+	}
+
+	return line
+}
+
+// printHeader prints the line at the top, which shows the name of the repo and
+// how many branches there are.
+func printHeader(w io.Writer, list *List, width int) int {
+	noun := "branches"
+	if len(list.all) == 1 {
+		noun = "branch"
+	}
+
+	header := fmt.Sprintf("%s — %d %s", list.repoName, len(list.all), noun)
+	if list.sort != "" {
+		header += ", by " + list.sort
+	}
+	if n := list.hidden(); n > 0 {
+		header += fmt.Sprintf(" (showing %d, %d more not shown)", list.limit, n)
+	}
+
+	fmt.Fprintf(w, "%s\r\n", runewidth.Truncate("   "+header, width, ""))
+	return 1
+}
+
+// printStatus prints the line above the table, which shows the current filter,
+// or a message.
+func printStatus(w io.Writer, list *List, width int) int {
+	status := "(press / to filter, ? for help)"
+	if list.question != "" {
+		status = fmt.Sprintf("%s %s", list.question, list.answer)
+	} else if list.message != "" {
+		status = list.message
+	} else if list.filtering {
+		status = fmt.Sprintf("filter: %s", list.filter)
+	} else if list.marking {
+		status = fmt.Sprintf("%d marked (press Space to mark, d to delete, Enter to choose)", len(list.markedBranches()))
+	}
+
+	if list.detached {
+		status = "(detached HEAD)  " + status
+	}
+
+	fmt.Fprintf(w, "%s\r\n", runewidth.Truncate("   "+status, width, ""))
+	return 1
+}
+
+// keyHelp describes the keys which can be pressed in the prompt.
+var keyHelp = [][2]string{
+	{"↑/↓, j/k, ^N/^P", "move the selection"},
+	{"Home/End, gg/G", "select the first or last branch"},
+	{"PgUp/PgDn", "move the selection by a screenful"},
+	{"", "(moving past the end shows any branches beyond -n)"},
+	{"Enter", "switch to the selected branch, or print the marked ones"},
+	{"1-9", "switch to a numbered branch"},
+	{"click", "select a branch, or double click to switch to it"},
+	{"other letters", "jump to the next branch starting with the letters typed,"},
+	{"", "which can include any letter once the first is typed"},
+	{"' then letters", "jump, starting with any letter, like 'm for main"},
+	{"/", "filter branches by name (Esc to clear)"},
+	{"m", "start or stop marking branches, with Space, to act on together"},
+	{"d", "delete the selected branch, or the marked ones"},
+	{"n", "create a new branch from the selected one, and switch to it"},
+	{"r", "rename the selected branch"},
+	{"y", "copy the name of the selected branch"},
+	{"R", "show or hide remote branches"},
+	{"s", "sort by date, name, or recent checkouts, in turn"},
+	{"p", "show or hide the recent commits of the selected branch"},
+	{"D", "show or hide the files changed between HEAD and the selected branch"},
+	{"B", "show or hide where the selected branch diverged from the default branch"},
+	{"?", "show this help"},
+	{"q, Esc", "quit"},
+}
+
+// printHelp prints the keys which can be pressed, and what they do, truncated to
+// width. Returns the number of lines printed.
+func printHelp(w io.Writer, width int) int {
+	kw := 0
+	for _, kh := range keyHelp {
+		if n := runewidth.StringWidth(kh[0]); n > kw {
+			kw = n
+		}
+	}
+
+	fmt.Fprintf(w, "%s\r\n", runewidth.Truncate("   keys: (press any key to close)", width, ""))
+	for _, kh := range keyHelp {
+		line := fmt.Sprintf("     %s  %s", runewidth.FillRight(kh[0], kw), kh[1])
+		fmt.Fprintf(w, "%s\r\n", runewidth.Truncate(line, width, ""))
+	}
+
+	return len(keyHelp) + 1
+}
+
+// eraseLines moves the cursor up n lines, and clears everything from there to
+// the end of the screen.
+func eraseLines(w io.Writer, n int) {
+	if n > 0 {
+		fmt.Fprintf(w, "\x1b[%dA", n)
+	}
+	fmt.Fprintf(w, "\r\x1b[J")
+}
+
+// printSelected erases the markers printed next to the visible branches, and
+// prints the current one. below is the number of lines which have been printed
+// since the table, which are skipped over.
+func printSelected(w io.Writer, list *List, opts Options, below int) {
+	n := len(list.visible())
+	if n == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\x1b[%dA", n+below)
+
+	for i := 0; i < n; i++ {
+		// headers can't be selected, so leave them alone.
+		if list.branches[list.top+i].isHeader {
+			fmt.Fprintf(w, "\r\n")
+			continue
+		}
+
+		cursor := " "
+		if list.top+i == list.selected {
+			cursor = "*"
+			if opts.Color {
+				cursor = "\x1b[1m*\x1b[0m"
+			}
+		}
+		mark := " "
+		if list.marked[list.branches[list.top+i].Name] {
+			mark = "✓"
+		}
+		fmt.Fprintf(w, " %s%s\r\n", cursor, mark)
+	}
+
+	if below > 0 {
+		fmt.Fprintf(w, "\x1b[%dB", below)
+	}
+}
+
+// previewCommits is the number of commits shown in the preview.
+const previewCommits = 5
+
+// previewLines is the number of lines printed by printPreview.
+const previewLines = previewCommits + 1
+
+// printPreview prints details of the given branch below the table: its recent
+// commits if mode is "commits", how it differs from HEAD if mode is "diff", or
+// where it diverged from base (or the default branch) if mode is "base". It
+// always prints the same number of lines, even if b is nil or there's less
+// to show, so the rest of the screen doesn't move. The details are looked up
+// the first time each branch is previewed, and kept in cache.
+func printPreview(w io.Writer, repo *git.Repository, b *Branch, mode, base string, cache map[string][]string, width int) int {
+	if b == nil {
+		return printPreviewLines(w, nil, width)
+	}
+
+	title := "── " + b.Name
+	if mode == "diff" {
+		title += " vs HEAD"
+	}
+
+	key := mode + " " + b.Hash.String()
+	details, ok := cache[key]
+	if !ok {
+		var err error
+		switch mode {
+		case "commits":
+			details, err = recentCommits(repo, b.Hash, previewCommits)
+		case "diff":
+			// diffs of big trees can take a while, so say what's happening.
+			printPreviewLines(w, []string{title, "computing…"}, width)
+			details, err = diffStat(repo, b.Hash, previewLines-2)
+			eraseLines(w, previewLines)
+		case "base":
+			details, err = mergeBase(repo, b.Hash, base)
+		}
+		if err != nil {
+			details = []string{err.Error()}
+		}
+		cache[key] = details
+	}
+
+	return printPreviewLines(w, append([]string{title}, details...), width)
+}
+
+// printPreviewLines prints the given lines, truncated to width, and padded to
+// exactly previewLines.
+func printPreviewLines(w io.Writer, lines []string, width int) int {
+	for i := 0; i < previewLines; i++ {
+		line := ""
+		if i < len(lines) {
+			line = runewidth.Truncate("   "+lines[i], width, "")
+		}
+		fmt.Fprintf(w, "%s\r\n", line)
+	}
+
+	return previewLines
+}
+
+// diffStat returns a summary of the changes between HEAD and the given commit,
+// followed by the n files with the most changes.
+func diffStat(repo *git.Repository, hash plumbing.Hash, n int) ([]string, error) {
+	head, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("repo.Head: %w", err)
+	}
+
+	from, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("repo.CommitObject: %w", err)
+	}
+
+	to, err := repo.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("repo.CommitObject: %w", err)
+	}
+
+	patch, err := from.Patch(to)
+	if err != nil {
+		return nil, fmt.Errorf("Patch: %w", err)
+	}
+
+	stats := patch.Stats()
+	add, del := 0, 0
+	for _, fs := range stats {
+		add += fs.Addition
+		del += fs.Deletion
+	}
+
+	noun := "files"
+	if len(stats) == 1 {
+		noun = "file"
+	}
+	lines := []string{fmt.Sprintf("%d %s changed, +%d -%d", len(stats), noun, add, del)}
+
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].Addition+stats[i].Deletion > stats[j].Addition+stats[j].Deletion
+	})
+	for i, fs := range stats {
+		if i == n {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("+%-4d -%-4d %s", fs.Addition, fs.Deletion, sanitize(fs.Name)))
+	}
+
+	return lines, nil
+}
+
+// mergeBase returns the commit where the given commit diverged from the base
+// branch (see defaultBranch), and when that was.
+func mergeBase(repo *git.Repository, hash plumbing.Hash, name string) ([]string, error) {
+	base, err := defaultBranch(repo, name)
+	if err != nil {
+		return nil, fmt.Errorf("defaultBranch: %w", err)
+	}
+	if base == nil {
+		return []string{"no default branch"}, nil
+	}
+
+	from, err := repo.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("repo.CommitObject: %w", err)
+	}
+
+	to, err := repo.CommitObject(base.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("repo.CommitObject: %w", err)
+	}
+
+	commits, err := from.MergeBase(to)
+	if err != nil {
+		return nil, fmt.Errorf("MergeBase: %w", err)
+	}
+	if len(commits) == 0 {
+		return []string{fmt.Sprintf("no history in common with %s", base.Name().Short())}, nil
+	}
+
+	// criss-cross merges can leave several, but any of them will do.
+	c := commits[0]
+	subject, _, _ := strings.Cut(c.Message, "\n")
+	when := c.Committer.When
+
+	return []string{
+		fmt.Sprintf("branched from %s at %s  %s", base.Name().Short(), c.Hash.String()[:7], sanitize(subject)),
+		fmt.Sprintf("%s (%s)", when.Format("2006-01-02"), humanize.Time(when)),
+	}, nil
+}
+
+// togglePreview returns the preview mode to switch to when the key for mode is
+// pressed: mode, or none if it's already shown.
+func togglePreview(current, mode string) string {
+	if current == mode {
+		return ""
+	}
+	return mode
+}
+
+// recentCommits returns the short hash and subject of the last n commits
+// reachable from the given commit, newest first.
+func recentCommits(repo *git.Repository, hash plumbing.Hash, n int) ([]string, error) {
+	iter, err := repo.Log(&git.LogOptions{From: hash})
+	if err != nil {
+		return nil, fmt.Errorf("repo.Log: %w", err)
+	}
+	defer iter.Close()
+
+	var lines []string
+	for len(lines) < n {
+		c, err := iter.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("iter.Next: %w", err)
+		}
+
+		subject, _, _ := strings.Cut(c.Message, "\n")
+		lines = append(lines, fmt.Sprintf("%s  %s", c.Hash.String()[:7], sanitize(subject)))
+	}
+
+	return lines, nil
+}
+
+// spinnerFrames are drawn in turn by spinner.
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// spinner draws an animated spinner followed by msg on w until the returned
+// func is called, which erases it.
+func spinner(w io.Writer, msg string) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(100 * time.Millisecond)
+		defer t.Stop()
+
+		// wait for the first tick before drawing anything, so it doesn't
+		// flicker when whatever we're waiting for is quick.
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				if i > 0 {
+					fmt.Fprintf(w, "\r\x1b[K")
+				}
+				return
+			case <-t.C:
+				fmt.Fprintf(w, "\r%s %s", spinnerFrames[i%len(spinnerFrames)], msg)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
@@ -0,0 +1,229 @@
+package selector
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestPrintBranches(t *testing.T) {
+	date := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	l := NewList([]Branch{
+		{Name: "main", Date: date, Subject: "first", IsHead: true},
+		{Name: "feature/long", Date: date, Subject: "a much longer subject"},
+	})
+	l.height = 10
+
+	tests := []struct {
+		name  string
+		opts  Options
+		width int
+		want  string
+	}{
+		{
+			name:  "plain",
+			opts:  Options{NoHash: true, Date: "short"},
+			width: 80,
+			want: "   1  main          |  2024-01-02  |  first                \r\n" +
+				"   2  feature/long  |  2024-01-02  |  a much longer subject\r\n",
+		},
+		{
+			name:  "truncated",
+			opts:  Options{NoHash: true, Date: "short"},
+			width: 30,
+			want: "   1  main          |  2024-01\r\n" +
+				"   2  feature/long  |  2024-01\r\n",
+		},
+		{
+			name:  "narrow",
+			opts:  Options{NoHash: true, Date: "short"},
+			width: 12,
+			want: "   main\r\n" +
+				"   feature/l\r\n",
+		},
+		{
+			name:  "min name width",
+			opts:  Options{NoHash: true, Date: "short", MinNameWidth: 15},
+			width: 80,
+			want: "   1  main             |  2024-01-02  |  first                \r\n" +
+				"   2  feature/long     |  2024-01-02  |  a much longer subject\r\n",
+		},
+		{
+			name:  "max name width",
+			opts:  Options{NoHash: true, Date: "short", MaxNameWidth: 8},
+			width: 80,
+			want: "   1  main      |  2024-01-02  |  first                \r\n" +
+				"   2  feature…  |  2024-01-02  |  a much longer subject\r\n",
+		},
+		{
+			name:  "full ref",
+			opts:  Options{NoHash: true, Date: "short", FullRef: true},
+			width: 80,
+			want: "   1  refs/heads/main          |  2024-01-02  |  first                \r\n" +
+				"   2  refs/heads/feature/long  |  2024-01-02  |  a much longer subject\r\n",
+		},
+		{
+			name:  "head marker",
+			opts:  Options{NoHash: true, Date: "short", HeadMarker: true},
+			width: 80,
+			want: "   1  • main          |  2024-01-02  |  first                \r\n" +
+				"   2    feature/long  |  2024-01-02  |  a much longer subject\r\n",
+		},
+		{
+			name:  "separator",
+			opts:  Options{NoHash: true, Date: "short", Separator: "│"},
+			width: 80,
+			want: "   1  main          │  2024-01-02  │  first                \r\n" +
+				"   2  feature/long  │  2024-01-02  │  a much longer subject\r\n",
+		},
+		{
+			name:  "no separator",
+			opts:  Options{NoHash: true, Date: "short", NoSeparator: true},
+			width: 80,
+			want: "   1  main           2024-01-02   first                \r\n" +
+				"   2  feature/long   2024-01-02   a much longer subject\r\n",
+		},
+		{
+			name:  "columns",
+			opts:  Options{Date: "short", Columns: []string{"date", "name", "author"}},
+			width: 80,
+			want: "   1  2024-01-02  |  main        \r\n" +
+				"   2  2024-01-02  |  feature/long\r\n",
+		},
+		{
+			name:  "stale",
+			opts:  Options{NoHash: true, Date: "short", Stale: 24 * time.Hour},
+			width: 80,
+			want: "   1  main          |  2024-01-02 [stale]  |  first                \r\n" +
+				"   2  feature/long  |  2024-01-02 [stale]  |  a much longer subject\r\n",
+		},
+		{
+			name:  "stale color",
+			opts:  Options{NoHash: true, Date: "short", Stale: 24 * time.Hour, Color: true},
+			width: 80,
+			want: "\x1b[32m   1  main          |  2024-01-02 [stale]  |  first                \x1b[0m\r\n" +
+				"\x1b[2m   2  feature/long  |  2024-01-02 [stale]  |  a much longer subject\x1b[0m\r\n",
+		},
+		{
+			name:  "color",
+			opts:  Options{NoHash: true, Date: "short", Color: true},
+			width: 80,
+			want: "\x1b[32m   1  main          |  2024-01-02  |  first                \x1b[0m\r\n" +
+				"   2  feature/long  |  2024-01-02  |  a much longer subject\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			n := printBranches(&buf, l, tt.opts, tt.width)
+
+			if n != 2 {
+				t.Errorf("printBranches returned %d, want 2", n)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("printBranches printed:\n%q\nwant:\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintBranchesHighlight(t *testing.T) {
+	date := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	l := NewList([]Branch{
+		{Name: "main", Date: date, Subject: "first", IsHead: true},
+		{Name: "feature/Long", Date: date, Subject: "a much longer subject"},
+	})
+	l.height = 10
+	l.setFilter("LON")
+
+	tests := []struct {
+		name    string
+		columns []string
+		maxName int
+		width   int
+		want    string
+	}{
+		{"whole", nil, 0, 80, "   1  feature/\x1b[4mLon\x1b[24mg  |  2024-01-02  |  a much longer subject\r\n"},
+		{"narrow", nil, 0, 16, "   feature/\x1b[4mLon\x1b[24mg\r\n"},
+		{"truncated", nil, 0, 13, "   feature/\x1b[4mLo\x1b[24m\r\n"},
+		{"not first", []string{"date", "name"}, 0, 80, "   1  2024-01-02  |  feature/\x1b[4mLon\x1b[24mg\r\n"},
+		{"max name width", nil, 10, 80, "   1  feature/\x1b[4mL\x1b[24m…  |  2024-01-02  |  a much longer subject\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			printBranches(&buf, l, Options{NoHash: true, Date: "short", Color: true, Columns: tt.columns, MaxNameWidth: tt.maxName}, tt.width)
+
+			if got := buf.String(); got != tt.want {
+				t.Errorf("printBranches printed:\n%q\nwant:\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintSelected(t *testing.T) {
+	l := NewList(branches("a", "b", "c"))
+	l.height = 10
+	l.next()
+
+	var buf bytes.Buffer
+	printSelected(&buf, l, Options{}, 0)
+
+	want := "\x1b[3A   \r\n * \r\n   \r\n"
+	if got := buf.String(); got != want {
+		t.Errorf("printSelected printed %q, want %q", got, want)
+	}
+
+	l.toggleMark()
+	l.next()
+	l.toggleMark()
+
+	buf.Reset()
+	printSelected(&buf, l, Options{}, 0)
+
+	want = "\x1b[3A   \r\n  ✓\r\n *✓\r\n"
+	if got := buf.String(); got != want {
+		t.Errorf("printSelected with marks printed %q, want %q", got, want)
+	}
+}
+
+func TestTermSize(t *testing.T) {
+	tests := []struct {
+		columns, lines string
+		wantW, wantH   int
+	}{
+		{"", "", 80, 24},
+		{"120", "40", 120, 40},
+		{"100", "", 100, 24},
+		{"wide", "-5", 80, 24},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("COLUMNS", tt.columns)
+		t.Setenv("LINES", tt.lines)
+
+		// a buffer isn't a terminal, so only the environment counts.
+		w, h := termSize(&bytes.Buffer{})
+		if w != tt.wantW || h != tt.wantH {
+			t.Errorf("with COLUMNS=%q LINES=%q: termSize() = %d, %d, want %d, %d", tt.columns, tt.lines, w, h, tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestPrintBranchesTall(t *testing.T) {
+	names := make([]string, 300)
+	for i := range names {
+		names[i] = fmt.Sprintf("branch-%d", i)
+	}
+	l := NewList(branches(names...))
+	l.height = 300
+
+	// more rows than fit in a byte, for terminals which are very tall.
+	if n := printBranches(io.Discard, l, Options{}, 80); n != 300 {
+		t.Errorf("printBranches returned %d, want 300", n)
+	}
+}
@@ -0,0 +1,1752 @@
+// Package selector implements an interactive prompt for choosing one of the
+// branches in a git repo.
+package selector
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/mattn/go-tty"
+
+	"github.com/dustin/go-humanize"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+type List struct {
+	repoName string
+
+	// all is every branch which matched, but only the first limit of them are
+	// shown, unless filtering.
+	all      []Branch
+	limit    int
+	branches []Branch
+	selected int
+
+	// filtering is true if the user is typing a filter, in which case only
+	// branches whose name contains filter are shown.
+	filtering bool
+	filter    string
+
+	// substring is true if the filter must match a contiguous part of the
+	// name, rather than just the same characters in order. See match.
+	substring bool
+
+	// changed is true if the branches have changed since they were last
+	// printed, e.g. because the filter changed.
+	changed bool
+
+	// detached is true if HEAD doesn't point to a branch.
+	detached bool
+
+	// message is shown on the status line instead of the filter, until the
+	// next keypress.
+	message string
+
+	// question is asked on the status line while waiting for the user to
+	// type an answer, like the name of a new branch. answer is what they've
+	// typed so far.
+	question string
+	answer   string
+
+	// marking is true in multi-select mode, where Space marks branches to act
+	// on together. marked is the names of the marked branches.
+	marking bool
+	marked  map[string]bool
+
+	// sort is how the branches are sorted, as shown in the header. see
+	// sortBranches.
+	sort string
+
+	// group is true if branches with the same prefix should be shown together,
+	// under a header.
+	group bool
+
+	// wrap is true if moving past either end of the list should select the
+	// branch at the other end.
+	wrap bool
+
+	// top is the index of the first visible branch, and height is the number
+	// of branches which fit on the screen at once.
+	top    int
+	height int
+}
+
+type Branch struct {
+	Name    string
+	Hash    plumbing.Hash
+	Date    time.Time
+	Author  string
+	Email   string
+	Subject string
+	IsHead  bool
+
+	// IsRemote is true if this is a remote-tracking branch, like origin/foo.
+	// In that case, local is the name of the local branch which would track
+	// it (foo), and hasLocal is true if that branch already exists.
+	IsRemote bool
+	Local    string
+	HasLocal bool
+
+	// Upstream is the short name of the branch which this branch tracks, or
+	// empty if it doesn't have one. ahead and behind are the number of commits
+	// which this branch has that upstream doesn't, and vice versa.
+	Upstream string
+	Ahead    int
+	Behind   int
+
+	// Gone is true if upstream no longer exists, usually because it was
+	// deleted from the remote.
+	Gone bool
+
+	// IsTag is true if this is a tag rather than a branch, in which case
+	// Hash is the commit which it points to.
+	IsTag bool
+
+	// Worktree is the path of another worktree where this branch is checked
+	// out, if any. It can't be checked out here too.
+	Worktree string
+
+	// Commits is the number of commits on this branch which aren't on the
+	// default branch, if HasCommits is true. They're only counted on request,
+	// since it can be slow.
+	Commits    int
+	HasCommits bool
+
+	// isHeader is true if this isn't really a branch, but the header of a
+	// group of branches with the same prefix. Headers can't be selected.
+	isHeader bool
+}
+
+// Options are the settings which control which branches are listed, and how
+// the prompt behaves.
+type Options struct {
+	// Fetch is true if all remotes should be fetched before listing branches.
+	Fetch bool
+
+	// which branches are listed, and in what order. Count is how many are
+	// shown before scrolling past the end, or zero for all of them. Sort is one
+	// of date (the default), recent, name, or name-desc.
+	Count     int
+	Remote    bool
+	Tags      bool
+	NoCurrent bool
+	Pattern   string
+	Regex     *regexp.Regexp
+	Sort      string
+	Reverse   bool
+	Group     bool
+
+	// AuthoredBy matches the name or email of the author of the last commit
+	// of the listed branches.
+	AuthoredBy *regexp.Regexp
+
+	// Merged and NoMerged are revisions which the listed branches must (or
+	// must not) have been merged into. Either can be BaseBranch.
+	Merged   string
+	NoMerged string
+
+	// Base is the branch which others are based on, and merged into. The
+	// default is the one origin/HEAD points to, or main or master.
+	Base string
+
+	// Contains is a revision which the listed branches must include.
+	Contains string
+
+	// Since and Before, if set, are how long ago the last commit of the listed
+	// branches must be since (or before).
+	Since  time.Duration
+	Before time.Duration
+
+	// Match is how the filter typed in the prompt matches branch names: fuzzy
+	// (the default), or substring.
+	Match string
+
+	// Cache is true if branches should be cached between runs.
+	Cache bool
+
+	// which columns are shown, and how. Date is one of relative (the
+	// default), iso, short, or compact.
+	NoHash   bool
+	Upstream bool
+	Author   bool
+	Commits  bool
+	Date     string
+
+	// Stale, if set, is how long ago the last commit of a branch must be for it
+	// to be flagged as stale.
+	Stale time.Duration
+
+	// Columns, if set, are the names of the columns to show, in order, even
+	// if they'd otherwise be hidden. See ColumnNames.
+	Columns []string
+
+	// Separator is shown between columns, with space either side. The default
+	// is |. NoSeparator leaves just the space.
+	Separator   string
+	NoSeparator bool
+
+	// SubjectWidth is the maximum width of commit subjects, or zero for no
+	// limit.
+	SubjectWidth int
+
+	// MinNameWidth and MaxNameWidth bound the width of the name column, so
+	// short names don't collapse it, and long ones don't push everything else
+	// off the screen. Longer names are truncated. Zero means no bound.
+	MinNameWidth int
+	MaxNameWidth int
+
+	// HeadMarker is true if the branch which is checked out should be marked
+	// with a •, as well as (or rather than) in color.
+	HeadMarker bool
+
+	// FullRef is true if branches should be shown by their full ref name,
+	// like refs/heads/main, to tell local and remote branches apart.
+	FullRef bool
+
+	// Output is where the prompt is drawn. It should be a terminal, so its
+	// size is known. The default is stdout.
+	Output io.Writer
+
+	// Color is true if the output should include ANSI colors.
+	Color bool
+
+	// Quiet is true if nothing should be shown while fetching or loading
+	// branches, before the prompt.
+	Quiet bool
+
+	// how the prompt behaves. NoMouse disables clicking and scrolling, which
+	// leaves the mouse free to select text as usual. Remember is true if the
+	// branch chosen should be selected to begin with next time.
+	Wrap     bool
+	NoMouse  bool
+	Remember bool
+
+	// SkipHead is true if the branch which is already checked out shouldn't be
+	// selected to begin with, since there's no point switching to it.
+	SkipHead bool
+}
+
+// output returns the writer which the prompt should be drawn on.
+func (o *Options) output() io.Writer {
+	if o.Output == nil {
+		return os.Stdout
+	}
+	return o.Output
+}
+
+// spinner shows msg with a spinner until the returned func is called, unless
+// the options say to be quiet.
+func (o *Options) spinner(msg string) func() {
+	if o.Quiet {
+		return func() {}
+	}
+	return spinner(o.output(), msg)
+}
+
+// countCommits returns true if the commits on each branch should be counted,
+// because of Commits, or because the column was asked for.
+func (o *Options) countCommits() bool {
+	return o.Commits || slices.Contains(o.Columns, "commits")
+}
+
+// separator returns what to print between columns.
+func (o *Options) separator() string {
+	switch {
+	case o.NoSeparator:
+		return "   "
+	case o.Separator == "":
+		return "  |  "
+	default:
+		return "  " + o.Separator + "  "
+	}
+}
+
+// prefix returns the part of the branch name before the first slash, or an
+// empty string if there isn't one.
+func (b *Branch) prefix() string {
+	p, _, ok := strings.Cut(b.Name, "/")
+	if !ok {
+		return ""
+	}
+	return p
+}
+
+// refName returns the full name of the ref, like refs/heads/main.
+func (b *Branch) refName() plumbing.ReferenceName {
+	switch {
+	case b.IsTag:
+		return plumbing.NewTagReferenceName(b.Name)
+	case b.IsRemote:
+		return plumbing.ReferenceName("refs/remotes/" + b.Name)
+	default:
+		return plumbing.NewBranchReferenceName(b.Name)
+	}
+}
+
+// displayName returns the name of the branch to show: its full ref name with
+// -full-ref, or otherwise just Name. Either way, Name is at the end.
+func (b *Branch) displayName(fullRef bool) string {
+	if fullRef {
+		return b.refName().String()
+	}
+	return b.Name
+}
+
+// shortHash returns the abbreviated hash of the commit at the tip of the branch.
+func (b *Branch) shortHash() string {
+	return b.Hash.String()[:7]
+}
+
+// when returns the date of the commit at the tip of the branch, in the given
+// format: relative (like "3 days ago"), iso (RFC3339), or short (2006-01-02).
+func (b *Branch) when(format string) string {
+	switch format {
+	case "iso":
+		return b.Date.Format(time.RFC3339)
+	case "short":
+		return b.Date.Format("2006-01-02")
+	case "compact":
+		return compactAge(time.Since(b.Date))
+	default:
+		return humanize.Time(b.Date)
+	}
+}
+
+// tracking returns the number of commits ahead of and behind the upstream, like
+// "↑3 ↓1", or an empty string if the branch has no upstream.
+func (b *Branch) tracking() string {
+	if b.Gone {
+		return "[gone]"
+	}
+	if b.Upstream == "" {
+		return ""
+	}
+	return fmt.Sprintf("↑%d ↓%d", b.Ahead, b.Behind)
+}
+
+// compactAge returns a short form of how long ago something was, in the largest
+// unit which fits, like 5h, 3d, 2w, or 1mo.
+func compactAge(d time.Duration) string {
+	const day = 24 * time.Hour
+
+	switch {
+	case d < time.Minute:
+		return "now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d < day:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d < 7*day:
+		return fmt.Sprintf("%dd", d/day)
+	case d < 30*day:
+		return fmt.Sprintf("%dw", d/(7*day))
+	case d < 365*day:
+		return fmt.Sprintf("%dmo", d/(30*day))
+	default:
+		return fmt.Sprintf("%dy", d/(365*day))
+	}
+}
+
+// isStale returns true if the last commit of the branch is older than
+// threshold. Nothing is stale if the threshold is zero.
+func (b *Branch) isStale(threshold time.Duration) bool {
+	return threshold > 0 && time.Since(b.Date) > threshold
+}
+
+// NewList returns a List of the given branches, with the first one selected.
+func NewList(branches []Branch) *List {
+	l := &List{
+		all:   branches,
+		limit: len(branches),
+	}
+	l.setFilter("")
+
+	return l
+}
+
+// previous selects the branch prior to the one currently selected. If the first branch is selected, it selects the last branch if wrap is enabled, or does nothing.
+func (l *List) previous() {
+	for i := l.selected - 1; i >= 0; i-- {
+		if !l.branches[i].isHeader {
+			l.selected = i
+			return
+		}
+	}
+
+	if l.wrap {
+		l.last()
+	}
+}
+
+// next selects the branch after the one currently selected. If the last branch is selected, it selects the first branch if wrap is enabled, or does nothing.
+func (l *List) next() {
+	for i := l.selected + 1; i < len(l.branches); i++ {
+		if !l.branches[i].isHeader {
+			l.selected = i
+			return
+		}
+	}
+
+	// moving past the end shows any hidden branches, before wrapping.
+	if l.showAll() {
+		l.next()
+		return
+	}
+
+	if l.wrap {
+		l.first()
+	}
+}
+
+// first selects the first branch.
+func (l *List) first() {
+	l.selected = 0
+	l.settle(1)
+}
+
+// last selects the last branch.
+func (l *List) last() {
+	if len(l.branches) > 0 {
+		l.selected = len(l.branches) - 1
+		l.settle(-1)
+	}
+}
+
+// move moves the selection down by n branches (or up, if n is negative), stopping at either end of the list.
+func (l *List) move(n int) {
+	if n > 0 && l.selected+n > len(l.branches)-1 {
+		l.showAll()
+	}
+
+	l.selected += n
+	if l.selected > len(l.branches)-1 {
+		l.selected = len(l.branches) - 1
+	}
+	if l.selected < 0 {
+		l.selected = 0
+	}
+
+	if n < 0 {
+		l.settle(-1)
+	} else {
+		l.settle(1)
+	}
+}
+
+// settle moves the selection off of a group header, if it's on one, to the nearest branch in the given direction (1 for down, -1 for up), or the other direction if there are none.
+func (l *List) settle(dir int) {
+	for _, d := range []int{dir, -dir} {
+		for i := l.selected; i >= 0 && i < len(l.branches); i += d {
+			if !l.branches[i].isHeader {
+				l.selected = i
+				return
+			}
+		}
+	}
+}
+
+// pageSize returns the number of branches which are visible at once.
+func (l *List) pageSize() int {
+	if l.height < len(l.branches) {
+		return l.height
+	}
+	return len(l.branches)
+}
+
+// visible returns the slice of branches which fit on the screen.
+func (l *List) visible() []Branch {
+	end := l.top + l.pageSize()
+	if end > len(l.branches) {
+		end = len(l.branches)
+	}
+	return l.branches[l.top:end]
+}
+
+// scroll moves the viewport so that the selected branch is visible, and returns true if it moved.
+func (l *List) scroll() bool {
+	top := l.top
+
+	// don't leave empty rows at the bottom, e.g. after the list is filtered.
+	if m := len(l.branches) - l.pageSize(); top > m {
+		top = m
+	}
+
+	if l.selected >= top+l.pageSize() {
+		top = l.selected - l.pageSize() + 1
+	}
+	if l.selected < top {
+		top = l.selected
+
+		// keep the header of the selected branch's group in view, too.
+		if top > 0 && l.branches[top-1].isHeader && l.pageSize() > 1 {
+			top--
+		}
+	}
+	if top < 0 {
+		top = 0
+	}
+
+	moved := top != l.top
+	l.top = top
+	return moved
+}
+
+// selectedBranch returns the selected branch, or nil if the list is empty.
+func (l *List) selectedBranch() *Branch {
+	if len(l.branches) == 0 {
+		return nil
+	}
+	return &l.branches[l.selected]
+}
+
+func (l *List) selectedName() string {
+	if len(l.branches) == 0 {
+		return ""
+	}
+	return l.branches[l.selected].Name
+}
+
+// shortcuts returns the indices of the first nine visible branches, which can
+// be selected by pressing 1-9.
+func (l *List) shortcuts() []int {
+	var idx []int
+	for i := l.top; i < l.top+len(l.visible()) && len(idx) < 9; i++ {
+		if !l.branches[i].isHeader {
+			idx = append(idx, i)
+		}
+	}
+
+	return idx
+}
+
+// jump selects the next branch whose name starts with prefix (case-insensitive),
+// wrapping around to the start of the list. If skip is false, the selected
+// branch is included, so it stays selected if it still matches. Returns false
+// if no branches match.
+func (l *List) jump(prefix string, skip bool) bool {
+	prefix = strings.ToLower(prefix)
+	start := l.selected
+	if skip {
+		start++
+	}
+
+	for n := 0; n < len(l.branches); n++ {
+		i := (start + n) % len(l.branches)
+		b := &l.branches[i]
+		if !b.isHeader && strings.HasPrefix(strings.ToLower(b.Name), prefix) {
+			l.selected = i
+			return true
+		}
+	}
+
+	return false
+}
+
+// selectName selects the branch with the given name. Returns false if it isn't
+// shown.
+func (l *List) selectName(name string) bool {
+	for i, b := range l.branches {
+		if !b.isHeader && b.Name == name {
+			l.selected = i
+			return true
+		}
+	}
+
+	return false
+}
+
+// skipHead selects the next branch, if the one which is checked out is
+// selected, and there is another.
+func (l *List) skipHead() {
+	if b := l.selectedBranch(); b != nil && b.IsHead {
+		l.next()
+	}
+}
+
+// toggleMark marks the selected branch, or unmarks it if it's already marked.
+func (l *List) toggleMark() {
+	name := l.selectedName()
+	if name == "" {
+		return
+	}
+
+	if l.marked == nil {
+		l.marked = map[string]bool{}
+	}
+	if l.marked[name] {
+		delete(l.marked, name)
+	} else {
+		l.marked[name] = true
+	}
+}
+
+// markedBranches returns the marked branches, in the order they're listed.
+func (l *List) markedBranches() []Branch {
+	var marked []Branch
+	for _, b := range l.all {
+		if l.marked[b.Name] {
+			marked = append(marked, b)
+		}
+	}
+
+	return marked
+}
+
+// setFilter shows only the branches whose name matches the given string (see
+// match), best matches first, and clamps the selection to the filtered set.
+func (l *List) setFilter(filter string) {
+	l.filter = filter
+	l.branches = []Branch{}
+	l.changed = true
+
+	scores := map[string]int{}
+	for _, b := range l.all {
+		if _, score, ok := l.match(b.Name); ok {
+			l.branches = append(l.branches, b)
+			scores[b.Name] = score
+		}
+	}
+	if filter != "" {
+		slices.SortStableFunc(l.branches, func(a, b Branch) int {
+			return scores[b.Name] - scores[a.Name]
+		})
+	}
+
+	if filter == "" && len(l.branches) > l.limit {
+		l.branches = l.branches[:l.limit]
+	}
+
+	if l.group {
+		groupBranches(l.branches)
+		l.branches = withHeaders(l.branches)
+	}
+
+	if l.selected > len(l.branches)-1 {
+		l.selected = len(l.branches) - 1
+	}
+	if l.selected < 0 {
+		l.selected = 0
+	}
+	l.settle(1)
+}
+
+// hidden returns the number of branches which aren't shown because of the
+// limit.
+func (l *List) hidden() int {
+	if l.filter != "" || l.limit >= len(l.all) {
+		return 0
+	}
+	return len(l.all) - l.limit
+}
+
+// showAll shows the branches which were hidden because of the limit, if any,
+// and returns true if there were.
+func (l *List) showAll() bool {
+	if l.hidden() == 0 {
+		return false
+	}
+
+	l.limit = len(l.all)
+	l.setFilter(l.filter)
+	return true
+}
+
+// deleteBranch deletes the named local branch, even if it isn't merged.
+func deleteBranch(name string) error {
+	out, err := exec.Command("git", "branch", "-D", name).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git branch -D: %s", bytes.TrimSpace(out))
+	}
+
+	return nil
+}
+
+// validBranchName returns an error if name can't be used as a branch name.
+func validBranchName(name string) error {
+	if err := plumbing.NewBranchReferenceName(name).Validate(); err != nil {
+		return fmt.Errorf("invalid branch name: %q", name)
+	}
+
+	return nil
+}
+
+// createBranch creates a new branch called name, pointing to the same commit as
+// base, without switching to it.
+func createBranch(name, base string) error {
+	out, err := exec.Command("git", "branch", name, base).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git branch: %s", bytes.TrimSpace(out))
+	}
+
+	return nil
+}
+
+// renameBranch renames the local branch called old to name.
+func renameBranch(old, name string) error {
+	out, err := exec.Command("git", "branch", "-m", old, name).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git branch -m: %s", bytes.TrimSpace(out))
+	}
+
+	return nil
+}
+
+// fetchAll fetches from every remote, so remote-tracking branches are current.
+func fetchAll() error {
+	out, err := exec.Command("git", "fetch", "--all", "--quiet").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git fetch: %s", bytes.TrimSpace(out))
+	}
+
+	return nil
+}
+
+// clipboardCommands are the commands which copyToClipboard tries, in order, on
+// systems other than macOS and Windows.
+var clipboardCommands = [][]string{
+	{"wl-copy"},
+	{"xclip", "-selection", "clipboard"},
+	{"xsel", "--clipboard", "--input"},
+}
+
+// copyToClipboard copies s to the system clipboard, by piping it to whichever
+// clipboard command is available.
+func copyToClipboard(s string) error {
+	cmds := clipboardCommands
+	switch runtime.GOOS {
+	case "darwin":
+		cmds = [][]string{{"pbcopy"}}
+	case "windows":
+		cmds = [][]string{{"clip.exe"}}
+	}
+
+	for _, args := range cmds {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+
+		// leave stdout and stderr alone, since xclip and wl-copy stay in the
+		// background to serve the clipboard, and would hold a pipe open.
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin = strings.NewReader(s)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("no clipboard command found")
+}
+
+// commandKeys are the letters which are bound to commands in the prompt, so
+// they don't start a jump to a branch, unless typed after '. They can still
+// continue a jump which another letter started.
+const commandKeys = "qQjkgGmdnrysRpDB"
+
+// jumpTimeout is how long to wait between letters typed to jump to a branch,
+// before starting again with a new prefix.
+const jumpTimeout = 500 * time.Millisecond
+
+// ErrInterrupted is returned by Select when Ctrl-C is pressed, or the process
+// receives a signal asking it to stop, while the prompt is shown.
+var ErrInterrupted = errors.New("interrupted")
+
+// ErrNoBranches is returned by Select when there are no branches to choose
+// from, e.g. because none match the options.
+var ErrNoBranches = errors.New("no branches found")
+
+// recovered returns an error describing a panic recovered from a goroutine,
+// including where it happened.
+func recovered(r any) error {
+	return fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+}
+
+// Select shows a prompt on the terminal for choosing one of the branches in
+// repo, and returns the name of the one chosen, or an empty string if the prompt
+// was cancelled.
+func Select(repo *git.Repository, opts Options) (string, error) {
+	b, err := SelectBranch(repo, opts)
+	if err != nil || b == nil {
+		return "", err
+	}
+
+	return b.Name, nil
+}
+
+// SelectBranch is like Select, but returns the chosen Branch, or nil if the
+// prompt was cancelled. If several branches were chosen in multi-select mode,
+// it returns the first of them.
+func SelectBranch(repo *git.Repository, opts Options) (*Branch, error) {
+	bs, err := SelectBranches(repo, opts)
+	if err != nil || len(bs) == 0 {
+		return nil, err
+	}
+
+	return &bs[0], nil
+}
+
+// SelectBranches is like SelectBranch, but returns every branch chosen in
+// multi-select mode, or just the one chosen otherwise. Returns nil if the prompt
+// was cancelled.
+func SelectBranches(repo *git.Repository, opts Options) (_ []Branch, err error) {
+	restore, err := enableVT(opts.output())
+	if err != nil {
+		return nil, fmt.Errorf("enableVT: %w", err)
+	}
+	defer func() {
+		if rerr := restore(); rerr != nil && err == nil {
+			err = fmt.Errorf("restore: %w", rerr)
+		}
+	}()
+
+	if opts.Fetch {
+		stop := opts.spinner("fetching…")
+		err := fetchAll()
+		stop()
+		if err != nil {
+			return nil, fmt.Errorf("fetchAll: %w", err)
+		}
+	}
+
+	return prompt(repo, opts)
+}
+
+// SelectNumbered is the fallback for Select when there's no terminal to show
+// the prompt on. It prints a numbered list of branches to w, and reads the
+// number of one from r. Returns nil if none is chosen.
+func SelectNumbered(repo *git.Repository, opts Options, w io.Writer, r *bufio.Reader) (*Branch, error) {
+	if opts.Fetch {
+		err := fetchAll()
+		if err != nil {
+			return nil, fmt.Errorf("fetchAll: %w", err)
+		}
+	}
+
+	branches, err := getBranches(repo, opts)
+	if err != nil {
+		return nil, fmt.Errorf("getBranches: %w", err)
+	}
+
+	if branches.message != "" {
+		fmt.Fprintln(w, "warning:", branches.message)
+	}
+
+	choices := []*Branch{}
+	for i := range branches.branches {
+		if !branches.branches[i].isHeader {
+			choices = append(choices, &branches.branches[i])
+		}
+	}
+
+	if len(choices) == 0 {
+		return nil, ErrNoBranches
+	}
+
+	nw := 0
+	for _, b := range choices {
+		if n := runewidth.StringWidth(b.displayName(opts.FullRef)); n > nw {
+			nw = n
+		}
+	}
+
+	for i, b := range choices {
+		fmt.Fprintf(w, "%3d) %s  %s  %s\n", i+1, runewidth.FillRight(b.displayName(opts.FullRef), nw), b.when(opts.Date), b.Subject)
+	}
+
+	fmt.Fprintf(w, "branch number: ")
+	line, err := r.ReadString('\n')
+	if err != nil && line == "" {
+		return nil, nil
+	}
+
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(line)
+	if err != nil || n < 1 || n > len(choices) {
+		return nil, fmt.Errorf("invalid branch number: %q", line)
+	}
+
+	return choices[n-1], nil
+}
+
+// doubleClickTimeout is how soon a branch must be clicked again to switch to
+// it.
+const doubleClickTimeout = 400 * time.Millisecond
+
+// escapeTimeout is how long to wait for the rest of an escape sequence, before
+// deciding that it was just ESC.
+const escapeTimeout = 50 * time.Millisecond
+
+// partialEscape returns true if buf is the start of an escape sequence, like an
+// arrow key, which hasn't all been read yet.
+func partialEscape(buf []rune) bool {
+	if len(buf) == 0 || buf[0] != 27 {
+		return false
+	}
+	if len(buf) == 1 {
+		return true
+	}
+
+	// ESC O is followed by one more character, like ESC O H for Home.
+	if buf[1] == 'O' {
+		return len(buf) == 2
+	}
+
+	// ESC [ is followed by any number of parameters, and ends with a letter
+	// or ~, like ESC [ A for up or ESC [ 5 ~ for PgUp.
+	if buf[1] == '[' {
+		last := buf[len(buf)-1]
+		return len(buf) == 2 || last < 0x40 || last > 0x7e
+	}
+
+	return false
+}
+
+// readKeys reads keypresses from the terminal and sends them to keys, until an
+// error occurs, which is sent to errs, or done is closed.
+func readKeys(t *tty.TTY, keys chan<- []rune, errs chan<- error, done <-chan struct{}) {
+	defer close(keys)
+
+	// a panic here would kill the process without restoring the terminal, so
+	// pass it on to the prompt as an error instead.
+	defer func() {
+		if r := recover(); r != nil {
+			select {
+			case errs <- recovered(r):
+			default:
+			}
+		}
+	}()
+
+	for {
+		// wait until there's something to read, checking regularly whether
+		// we're done. otherwise we'd still be blocked reading after the prompt
+		// exits, and swallow input meant for something else.
+		ready := t.Buffered()
+		if !ready {
+			var err error
+			ready, err = waitForInput(t.Input(), 50*time.Millisecond)
+			if err != nil {
+				errs <- err
+				return
+			}
+		}
+
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		if !ready {
+			continue
+		}
+
+		// read one keypress
+		// damn this is complicated
+		// see: https://www.asciitable.com
+		buf := []rune{}
+		for {
+			r, err := t.ReadRune()
+			if err != nil {
+				errs <- err
+				return
+			}
+			// some events, like keys being released on Windows, don't
+			// produce a rune. don't wait for another if there isn't one.
+			if r == 0 {
+				if !t.Buffered() {
+					break
+				}
+				continue
+			}
+			buf = append(buf, r)
+			if t.Buffered() {
+				continue
+			}
+
+			// over a slow connection, the rest of an escape sequence might
+			// arrive a little after the ESC which starts it. wait briefly for
+			// it, so an arrow key isn't mistaken for ESC.
+			if !partialEscape(buf) {
+				break
+			}
+			more, err := waitForInput(t.Input(), escapeTimeout)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if !more {
+				break
+			}
+		}
+
+		if len(buf) == 0 {
+			continue
+		}
+
+		select {
+		case keys <- buf:
+		case <-done:
+			return
+		}
+	}
+}
+
+// prompt shows the prompt, and returns the branches which were chosen, or nil
+// if it was cancelled. The terminal is always restored before it returns, even
+// if there's an error, or a panic; deferred calls still run while panicking.
+func prompt(repo *git.Repository, opts Options) (chosen []Branch, err error) {
+	out := opts.output()
+
+	stop := opts.spinner("loading branches…")
+	branches, err := getBranches(repo, opts)
+	stop()
+	if err != nil {
+		return nil, fmt.Errorf("getBranches: %w", err)
+	}
+
+	if len(branches.all) == 0 {
+		return nil, ErrNoBranches
+	}
+
+	branches.wrap = opts.Wrap
+
+	// start where we left off last time, if that branch is still here.
+	if opts.Remember {
+		if last := readLast(repo); last != "" {
+			branches.selectName(last)
+		}
+	}
+	// that's often the branch which is checked out now, though.
+	if opts.SkipHead {
+		branches.skipHead()
+	}
+	defer func() {
+		if opts.Remember && len(chosen) == 1 {
+			writeLast(repo, chosen[0].Name)
+		}
+	}()
+
+	// reload lists the branches again, e.g. after one was deleted, keeping the
+	// filter and selection.
+	reload := func() error {
+		fresh, err := getBranches(repo, opts)
+		if err != nil {
+			return fmt.Errorf("getBranches: %w", err)
+		}
+		branches.all = fresh.all
+		branches.limit = max(branches.limit, fresh.limit)
+		branches.setFilter(branches.filter)
+		return nil
+	}
+
+	// whether the help is being shown instead of the branches.
+	showHelp := false
+
+	// the order of the most recent checkouts, once it's needed to sort by it.
+	var recent map[string]int
+
+	// an action which is waiting for the user to press y to confirm it.
+	// the question is shown as the message meanwhile. if it fails, the prompt
+	// exits with the error.
+	var confirm func() error
+
+	// an action which is waiting for the user to type an answer to the
+	// question on the status line. if it returns a branch, the prompt exits
+	// with it, as if it was chosen.
+	var answered func(answer string) (*Branch, error)
+
+	t, err := tty.Open()
+	if err != nil {
+		return nil, fmt.Errorf("tty.Open: %w", err)
+	}
+	defer func() {
+		if cerr := t.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("t.Close: %w", cerr)
+		}
+	}()
+
+	// put terminal into raw mode, so we can listen for keys.
+	revert, err := t.Raw()
+	if err != nil {
+		return nil, fmt.Errorf("t.Raw: %w", err)
+	}
+	defer func() {
+		if rerr := revert(); rerr != nil && err == nil {
+			err = fmt.Errorf("revert: %w", rerr)
+		}
+	}()
+
+	// report mouse clicks and scrolling as escape sequences, like keys.
+	if !opts.NoMouse {
+		fmt.Fprint(out, mouseOn)
+		defer fmt.Fprint(out, mouseOff)
+	}
+
+	// read keys in the background, so we can also listen for signals. wait
+	// for it to stop before returning, so it doesn't read anything else.
+	keys := make(chan []rune)
+	errs := make(chan error, 1)
+	done := make(chan struct{})
+	go readKeys(t, keys, errs, done)
+	defer func() {
+		close(done)
+		for range keys {
+		}
+	}()
+
+	// listen for the terminal being resized, so we can redraw to fit.
+	resized, stopResize := watchResize(out)
+	defer stopResize()
+
+	// the terminal doesn't send SIGINT for Ctrl-C in raw mode, but we might
+	// still be killed by something else. if so, return rather than dying, so
+	// the terminal is restored on the way out.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+
+	// the letters typed to jump to a branch, and when the last was typed.
+	// quoted is true after ', so the next letter jumps even if it's bound to
+	// a command.
+	jump := ""
+	var jumpedAt time.Time
+	quoted := false
+
+	// when g was last pressed, to tell if the next g makes gg.
+	var gAt time.Time
+
+	// the number of lines printed by the last redraw, so we know how many to
+	// erase before the next one.
+	var lines int
+	redraw := true
+
+	// what's shown below the table about the selected branch, if anything
+	// (see printPreview), which branch it's shown for, and the details looked
+	// up so far.
+	preview := ""
+	previewed := ""
+	previewCache := map[string][]string{}
+
+	// the screen row of the first visible branch, or zero if it isn't known
+	// yet, so we can tell which was clicked. after each redraw, we ask where
+	// the cursor is, and work it out from that. also the branch which was last
+	// clicked, and when, to spot double clicks.
+	tableTop := 0
+	askPos := false
+	clicked := -1
+	var clickedAt time.Time
+
+	for {
+		// leave room for the header and status lines above the table, the
+		// preview below it, and the cursor below that.
+		var below int
+		if preview != "" {
+			below = previewLines
+		}
+		width, height := termSize(out)
+		branches.height = height - 3 - below
+		if branches.height < 1 {
+			branches.height = 1
+		}
+
+		// print the table containing all the info. we only do this when the
+		// filter changes, the list scrolls, or the terminal is resized, because otherwise the only thing
+		// that changes every keypress is the position of the selected marker.
+		if branches.scroll() || branches.changed {
+			branches.changed = false
+			redraw = true
+		}
+		if redraw {
+			eraseLines(out, lines)
+			if showHelp {
+				lines = printHelp(out, width)
+			} else {
+				lines = printHeader(out, branches, width) + printStatus(out, branches, width) + printBranches(out, branches, opts, width)
+				if preview != "" {
+					lines += printPreview(out, repo, branches.selectedBranch(), preview, opts.Base, previewCache, width)
+					previewed = branches.selectedName()
+				}
+			}
+			redraw = false
+			askPos = !opts.NoMouse
+		}
+
+		// when the selection moves, redraw just the preview, rather than the
+		// whole table, to avoid flickering.
+		if !showHelp && preview != "" && previewed != branches.selectedName() {
+			eraseLines(out, below)
+			printPreview(out, repo, branches.selectedBranch(), preview, opts.Base, previewCache, width)
+			previewed = branches.selectedName()
+		}
+
+		// erase any previously-printed markers, and print the current one.
+		if !showHelp {
+			printSelected(out, branches, opts, below)
+		}
+		if askPos {
+			fmt.Fprint(out, "\x1b[6n")
+			askPos = false
+		}
+
+		// wait for a keypress, or for the terminal to be resized.
+		var buf []rune
+		select {
+		case buf = <-keys:
+		case err := <-errs:
+			return nil, fmt.Errorf("t.ReadRune: %w", err)
+		case sig := <-sigs:
+			return nil, fmt.Errorf("%w: %s", ErrInterrupted, sig)
+		case <-resized:
+			// the terminal might have reflowed the lines we already printed,
+			// so we can't know how many to erase. clear the whole screen and
+			// start again from the top.
+			fmt.Fprintf(out, "\x1b[H\x1b[2J")
+			lines = 0
+			redraw = true
+			continue
+		}
+
+		// the cursor is left below the table, and the preview if it's shown.
+		if row, ok := parseCursorPos(buf); ok {
+			tableTop = row - below - len(branches.visible())
+			continue
+		}
+
+		// click a branch to select it, and click it again quickly to switch
+		// to it. scroll to move the selection, like the arrow keys. this does
+		// nothing while waiting for anything else.
+		if ev, ok := parseMouse(buf); ok {
+			if !ev.press || showHelp || confirm != nil || branches.question != "" {
+				continue
+			}
+
+			switch ev.button {
+			case mouseWheelUp:
+				branches.previous()
+			case mouseWheelDown:
+				branches.next()
+			case mouseLeft:
+				idx, ok := branches.rowAt(ev.y, tableTop)
+				if !ok || tableTop == 0 {
+					break
+				}
+				if idx == clicked && time.Since(clickedAt) < doubleClickTimeout {
+					return []Branch{branches.branches[idx]}, nil
+				}
+				branches.selected = idx
+				clicked = idx
+				clickedAt = time.Now()
+			}
+			continue
+		}
+
+		// any keypress dismisses the help, and does nothing else.
+		if showHelp {
+			showHelp = false
+			redraw = true
+			continue
+		}
+
+		// any keypress dismisses the message.
+		if branches.message != "" {
+			branches.message = ""
+			redraw = true
+		}
+
+		// if we're waiting for confirmation, press y to go ahead, or anything
+		// else to cancel.
+		if confirm != nil {
+			f := confirm
+			confirm = nil
+			if len(buf) == 1 && (buf[0] == 'y' || buf[0] == 'Y') {
+				if err := f(); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		// if we're waiting for an answer, type it and press Enter, or ESC to
+		// cancel.
+		if branches.question != "" {
+			// ignore escape sequences, like arrow keys.
+			if len(buf) > 1 && buf[0] == 27 {
+				continue
+			}
+
+			// more than one key might arrive at once when pasting.
+			for _, r := range buf {
+				switch {
+				case r == 27 || r == 3:
+					branches.question = ""
+
+				case r == 13:
+					answer := strings.TrimSpace(branches.answer)
+					branches.question = ""
+					if answer != "" {
+						b, err := answered(answer)
+						if err != nil {
+							return nil, err
+						}
+						if b != nil {
+							return []Branch{*b}, nil
+						}
+					}
+
+				case r == 127 || r == 8:
+					if a := branches.answer; a != "" {
+						branches.answer = a[:len(a)-1]
+					}
+
+				case r >= 0x20 && r <= 0x7e:
+					branches.answer += string(r)
+				}
+
+				if branches.question == "" {
+					break
+				}
+			}
+
+			redraw = true
+			continue
+		}
+
+		// press ESC while filtering to clear the filter, rather than exit.
+		if len(buf) == 1 && buf[0] == 27 && branches.filtering {
+			branches.filtering = false
+			branches.setFilter("")
+			redraw = true
+			continue
+		}
+
+		// likewise, press ESC in multi-select mode to leave it.
+		if len(buf) == 1 && buf[0] == 27 && branches.marking {
+			branches.marking = false
+			branches.marked = nil
+			redraw = true
+			continue
+		}
+
+		// to exit, press: ESC, Q, or q. ETX (end of text) is received when
+		// ctrl+c is pressed, which is an interruption rather than a choice.
+		if len(buf) == 1 && buf[0] == 3 {
+			return nil, ErrInterrupted
+		}
+		if len(buf) == 1 && buf[0] == 27 {
+			return nil, nil
+		}
+
+		// press Enter (CR) to switch to selected branch and exit, or choose
+		// the marked branches if there are any. this does nothing if the
+		// filter doesn't match any branches.
+		if len(buf) == 1 && buf[0] == 13 {
+			if marked := branches.markedBranches(); len(marked) > 0 {
+				return marked, nil
+			}
+			if b := branches.selectedBranch(); b != nil {
+				return []Branch{*b}, nil
+			}
+			continue
+		}
+
+		// press Space in multi-select mode to mark or unmark the selected
+		// branch.
+		if len(buf) == 1 && buf[0] == ' ' && branches.marking {
+			branches.toggleMark()
+			redraw = true
+			continue
+		}
+
+		// press Ctrl-N/Ctrl-P to change selected branch, like emacs. unlike j/k,
+		// these work while filtering.
+		if len(buf) == 1 && (buf[0] == 0x0e || buf[0] == 0x10) {
+			if buf[0] == 0x0e {
+				branches.next()
+			} else {
+				branches.previous()
+			}
+			continue
+		}
+
+		// like answers, more than one key might arrive at once when pasting,
+		// or typing quickly over ssh. escape sequences are ignored.
+		if branches.filtering && buf[0] != 27 {
+			filter := branches.filter
+			for _, r := range buf {
+				switch {
+				// press Backspace (DEL, or BS on Windows) to remove the last
+				// character of the filter, or to stop filtering if it's
+				// already empty.
+				case r == 127 || r == 8:
+					if filter != "" {
+						filter = filter[:len(filter)-1]
+					} else {
+						branches.filtering = false
+					}
+
+				// press any other printable character to add it to the
+				// filter.
+				case r >= 0x20 && r <= 0x7e:
+					filter += string(r)
+				}
+
+				if !branches.filtering {
+					break
+				}
+			}
+
+			if filter != branches.filter {
+				branches.setFilter(filter)
+			}
+			redraw = true
+			continue
+		}
+
+		if !branches.filtering && len(buf) == 1 {
+			// letters bound to commands can't start a jump, but once one has
+			// started, every letter continues it, so "fs" can reach
+			// feature/search. any other key ends the jump.
+			r := buf[0]
+			jumping := unicode.IsLetter(r) && r <= 0x7e &&
+				(quoted || time.Since(jumpedAt) <= jumpTimeout || !strings.ContainsRune(commandKeys, r))
+			if !jumping {
+				jumpedAt = time.Time{}
+			}
+			quoted = false
+
+			switch {
+			// press a letter to jump to the next branch starting with it.
+			// letters typed in quick succession are combined, so "fe" jumps
+			// to the first branch starting with "fe". pressing the same letter
+			// repeatedly cycles through the branches starting with it.
+			case jumping:
+				if time.Since(jumpedAt) > jumpTimeout {
+					jump = ""
+				}
+				jump += string(r)
+				jumpedAt = time.Now()
+
+				if strings.Count(jump, string(r)) == len(jump) {
+					branches.jump(string(r), true)
+				} else {
+					branches.jump(jump, false)
+				}
+
+			// press ' then a letter to jump with a letter which is bound to
+			// a command, like 'm for main.
+			case r == '\'':
+				quoted = true
+
+			case r == 'q' || r == 'Q':
+				return nil, nil
+
+			// press j/k to change selected branch, like vim.
+			case r == 'k': // up
+				branches.previous()
+			case r == 'j': // down
+				branches.next()
+
+			// press 1-9 to switch to one of the first visible branches, as
+			// labelled, and exit.
+			case r >= '1' && r <= '9':
+				if idx := branches.shortcuts(); int(r-'1') < len(idx) {
+					return []Branch{branches.branches[idx[r-'1']]}, nil
+				}
+
+			// press m to start or stop marking branches to act on
+			// together.
+			case r == 'm':
+				branches.marking = !branches.marking
+				branches.marked = nil
+				redraw = true
+
+			// press d to delete the marked branches, after confirming.
+			case r == 'd' && len(branches.markedBranches()) > 0:
+				marked := branches.markedBranches()
+				names := make([]string, 0, len(marked))
+				for _, b := range marked {
+					if b.IsHead {
+						branches.message = "can't delete the current branch"
+						break
+					}
+					if b.IsRemote {
+						branches.message = "can't delete remote branches"
+						break
+					}
+					if b.IsTag {
+						branches.message = "can't delete tags"
+						break
+					}
+					names = append(names, b.Name)
+				}
+				redraw = true
+				if branches.message != "" {
+					break
+				}
+
+				branches.message = fmt.Sprintf("delete %d branches? (y/n)", len(names))
+				confirm = func() error {
+					for i, name := range names {
+						if err := deleteBranch(name); err != nil {
+							branches.message = fmt.Sprintf("deleted %d branches, then: %s", i, err)
+							return reload()
+						}
+					}
+					branches.message = fmt.Sprintf("deleted %d branches", len(names))
+					branches.marked = nil
+					return reload()
+				}
+
+			// otherwise, press d to delete the selected branch, after
+			// confirming.
+			case r == 'd':
+				b := branches.selectedBranch()
+				if b == nil {
+					break
+				}
+				if b.IsHead {
+					branches.message = "can't delete the current branch"
+					redraw = true
+					break
+				}
+				if b.IsRemote {
+					branches.message = "can't delete remote branches"
+					redraw = true
+					break
+				}
+				if b.IsTag {
+					branches.message = "can't delete tags"
+					redraw = true
+					break
+				}
+
+				name := b.Name
+				branches.message = fmt.Sprintf("delete %s? (y/n)", name)
+				redraw = true
+				confirm = func() error {
+					err := deleteBranch(name)
+					if err != nil {
+						branches.message = err.Error()
+						return nil
+					}
+					branches.message = fmt.Sprintf("deleted %s", name)
+					return reload()
+				}
+
+			// press n to create a new branch from the selected one, and switch
+			// to it.
+			case r == 'n':
+				base := branches.selectedBranch()
+				if base == nil {
+					break
+				}
+
+				branches.question = fmt.Sprintf("new branch from %s:", base.Name)
+				branches.answer = ""
+				redraw = true
+				answered = func(name string) (*Branch, error) {
+					if err := validBranchName(name); err != nil {
+						branches.message = err.Error()
+						return nil, nil
+					}
+					if err := createBranch(name, base.Name); err != nil {
+						branches.message = err.Error()
+						return nil, nil
+					}
+
+					// it points to the same commit as the base.
+					return &Branch{
+						Name:    name,
+						Hash:    base.Hash,
+						Date:    base.Date,
+						Author:  base.Author,
+						Subject: base.Subject,
+					}, nil
+				}
+
+			// press r to rename the selected branch.
+			case r == 'r':
+				b := branches.selectedBranch()
+				if b == nil {
+					break
+				}
+				if b.IsRemote || b.IsTag {
+					branches.message = "can only rename local branches"
+					redraw = true
+					break
+				}
+
+				old := b.Name
+				branches.question = fmt.Sprintf("rename %s to:", old)
+				branches.answer = old
+				redraw = true
+				answered = func(name string) (*Branch, error) {
+					if name == old {
+						return nil, nil
+					}
+					if err := validBranchName(name); err != nil {
+						branches.message = err.Error()
+						return nil, nil
+					}
+					for _, other := range branches.all {
+						if !other.IsRemote && other.Name == name {
+							branches.message = fmt.Sprintf("%s already exists", name)
+							return nil, nil
+						}
+					}
+					if err := renameBranch(old, name); err != nil {
+						branches.message = err.Error()
+						return nil, nil
+					}
+
+					branches.message = fmt.Sprintf("renamed %s to %s", old, name)
+					if err := reload(); err != nil {
+						return nil, err
+					}
+					branches.selectName(name)
+					return nil, nil
+				}
+
+			// press y to copy the name of the selected branch to the clipboard.
+			case r == 'y':
+				name := branches.selectedName()
+				if name == "" {
+					break
+				}
+				if err := copyToClipboard(name); err != nil {
+					branches.message = err.Error()
+				} else {
+					branches.message = fmt.Sprintf("copied %s", name)
+				}
+				redraw = true
+
+			// press R to show or hide remote branches, keeping the same
+			// branch selected if it's still listed, or its local branch if
+			// not.
+			case r == 'R':
+				b := branches.selectedBranch()
+				opts.Remote = !opts.Remote
+				if err := reload(); err != nil {
+					return nil, err
+				}
+				if b != nil && !branches.selectName(b.Name) && b.Local != "" {
+					branches.selectName(b.Local)
+				}
+				if opts.Remote {
+					branches.message = "showing remote branches"
+				} else {
+					branches.message = "hiding remote branches"
+				}
+				redraw = true
+
+			// press s to sort by the next of sortModes, keeping the same
+			// branch selected.
+			case r == 's':
+				opts.Sort = nextSort(opts.Sort)
+				if opts.Sort == "recent" && recent == nil {
+					recent, err = recentCheckouts(repo)
+					if err != nil {
+						return nil, fmt.Errorf("recentCheckouts: %w", err)
+					}
+				}
+				err = sortBranches(branches.all, opts.Sort, recent)
+				if err != nil {
+					return nil, err
+				}
+				if opts.Reverse {
+					slices.Reverse(branches.all)
+				}
+				name := branches.selectedName()
+				branches.sort = opts.Sort
+				branches.setFilter(branches.filter)
+				branches.selectName(name)
+				redraw = true
+
+			// press p to show or hide the recent commits of the selected
+			// branch.
+			case r == 'p':
+				preview = togglePreview(preview, "commits")
+				redraw = true
+
+			// press D to show or hide how the selected branch differs from
+			// HEAD.
+			case r == 'D':
+				preview = togglePreview(preview, "diff")
+				redraw = true
+
+			// press B to show or hide where the selected branch diverged from
+			// the default branch.
+			case r == 'B':
+				preview = togglePreview(preview, "base")
+				redraw = true
+
+			// press ? to show the help.
+			case r == '?':
+				showHelp = true
+				redraw = true
+
+			// press / to start filtering.
+			case r == '/':
+				branches.filtering = true
+				redraw = true
+
+			// press G to select the last branch, or gg the first, like vim.
+			case r == 'G':
+				branches.last()
+			case r == 'g':
+				if time.Since(gAt) <= jumpTimeout {
+					branches.first()
+					gAt = time.Time{}
+				} else {
+					gAt = time.Now()
+				}
+			}
+			continue
+		}
+
+		// press up/down to change selected branch
+		if len(buf) == 3 && (buf[0] == 27 && buf[1] == '[') {
+			if buf[2] == 'A' { // up
+				branches.previous()
+			} else if buf[2] == 'B' { // down
+				branches.next()
+			} else if buf[2] == 'H' { // home
+				branches.first()
+			} else if buf[2] == 'F' { // end
+				branches.last()
+			}
+		}
+
+		// press page up/down to move the selection by a screenful
+		if len(buf) == 4 && (buf[0] == 27 && buf[1] == '[' && buf[3] == '~') {
+			if buf[2] == '5' { // page up
+				branches.move(-branches.pageSize())
+			} else if buf[2] == '6' { // page down
+				branches.move(branches.pageSize())
+			}
+		}
+	}
+}
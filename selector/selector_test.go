@@ -0,0 +1,324 @@
+package selector
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// branches returns a Branch with each of the given names.
+func branches(names ...string) []Branch {
+	bs := make([]Branch, len(names))
+	for i, name := range names {
+		bs[i] = Branch{Name: name}
+	}
+	return bs
+}
+
+func TestListNavigation(t *testing.T) {
+	tests := []struct {
+		name     string
+		branches []string
+		wrap     bool
+
+		// keys is the moves to make, where j is next and k is previous.
+		keys string
+		want string
+	}{
+		{"empty", nil, false, "", ""},
+		{"empty next", nil, false, "j", ""},
+		{"empty previous", nil, false, "k", ""},
+		{"empty wrap", nil, true, "jk", ""},
+		{"single", []string{"a"}, false, "", "a"},
+		{"single next", []string{"a"}, false, "j", "a"},
+		{"single previous", []string{"a"}, false, "k", "a"},
+		{"single wrap", []string{"a"}, true, "jjkk", "a"},
+		{"first", []string{"a", "b", "c"}, false, "", "a"},
+		{"next", []string{"a", "b", "c"}, false, "j", "b"},
+		{"next and back", []string{"a", "b", "c"}, false, "jk", "a"},
+		{"last", []string{"a", "b", "c"}, false, "jj", "c"},
+		{"past last", []string{"a", "b", "c"}, false, "jjj", "c"},
+		{"before first", []string{"a", "b", "c"}, false, "k", "a"},
+		{"wrap past last", []string{"a", "b", "c"}, true, "jjj", "a"},
+		{"wrap before first", []string{"a", "b", "c"}, true, "k", "c"},
+		{"wrap both ways", []string{"a", "b", "c"}, true, "kj", "a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewList(branches(tt.branches...))
+			l.wrap = tt.wrap
+
+			for _, k := range tt.keys {
+				switch k {
+				case 'j':
+					l.next()
+				case 'k':
+					l.previous()
+				}
+			}
+
+			if got := l.selectedName(); got != tt.want {
+				t.Errorf("after %q: selectedName() = %q, want %q", tt.keys, got, tt.want)
+			}
+		})
+	}
+}
+
+// grouped returns a List of the given rows, where names ending in / are group
+// headers, as if by -group.
+func grouped(rows ...string) *List {
+	l := &List{}
+	for _, name := range rows {
+		b := Branch{Name: name, isHeader: strings.HasSuffix(name, "/")}
+		if !b.isHeader {
+			l.all = append(l.all, b)
+		}
+		l.branches = append(l.branches, b)
+	}
+	l.limit = len(l.all)
+	l.settle(1)
+
+	return l
+}
+
+func TestListNavigationGroups(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []string
+		wrap bool
+
+		// keys is the moves to make, where j is next, k is previous, g is
+		// first, and G is last.
+		keys string
+		want string
+	}{
+		{"header first", []string{"a/", "a/1", "a/2"}, false, "", "a/1"},
+		{"header first previous", []string{"a/", "a/1", "a/2"}, false, "k", "a/1"},
+		{"header first first", []string{"a/", "a/1", "a/2"}, false, "jg", "a/1"},
+		{"header last", []string{"a/1", "a/2", "b/"}, false, "jj", "a/2"},
+		{"header last last", []string{"a/1", "a/2", "b/"}, false, "G", "a/2"},
+		{"adjacent groups next", []string{"a/", "a/1", "b/", "b/1"}, false, "j", "b/1"},
+		{"adjacent groups back", []string{"a/", "a/1", "b/", "b/1"}, false, "jk", "a/1"},
+		{"adjacent headers", []string{"a/", "b/", "b/1", "c/", "d/", "d/1"}, false, "j", "d/1"},
+		{"adjacent headers back", []string{"a/", "b/", "b/1", "c/", "d/", "d/1"}, false, "jk", "b/1"},
+		{"wrap past last", []string{"a/", "a/1", "b/", "b/1"}, true, "jj", "a/1"},
+		{"wrap before first", []string{"a/", "a/1", "b/", "b/1"}, true, "k", "b/1"},
+		{"wrap header last", []string{"a/1", "b/", "b/1", "c/"}, true, "jj", "a/1"},
+		{"wrap header last back", []string{"a/1", "b/", "b/1", "c/"}, true, "k", "b/1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := grouped(tt.rows...)
+			l.wrap = tt.wrap
+
+			for i, k := range tt.keys {
+				switch k {
+				case 'j':
+					l.next()
+				case 'k':
+					l.previous()
+				case 'g':
+					l.first()
+				case 'G':
+					l.last()
+				}
+
+				if b := l.selectedBranch(); b != nil && b.isHeader {
+					t.Fatalf("after %q: selected header %q", tt.keys[:i+1], b.Name)
+				}
+			}
+
+			if got := l.selectedName(); got != tt.want {
+				t.Errorf("after %q: selectedName() = %q, want %q", tt.keys, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListGroupHeaders(t *testing.T) {
+	l := NewList(branches("a/1", "main", "b/1", "a/2"))
+	l.group = true
+	l.setFilter("")
+
+	// main has no prefix, so goes first, then a/ and b/ with their headers.
+	var got []string
+	for l.selectedBranch() != nil {
+		got = append(got, l.selectedName())
+		if l.selected == len(l.branches)-1 {
+			break
+		}
+		l.next()
+	}
+	if want := []string{"main", "a/1", "a/2", "b/1"}; !slices.Equal(got, want) {
+		t.Errorf("visited %v, want %v", got, want)
+	}
+
+	l.first()
+	l.previous()
+	if got := l.selectedName(); got != "main" {
+		t.Errorf("before first: selectedName() = %q, want main", got)
+	}
+}
+
+func TestListFirstLast(t *testing.T) {
+	tests := []struct {
+		name      string
+		branches  []string
+		wantFirst string
+		wantLast  string
+	}{
+		{"empty", nil, "", ""},
+		{"single", []string{"a"}, "a", "a"},
+		{"several", []string{"a", "b", "c"}, "a", "c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewList(branches(tt.branches...))
+
+			l.last()
+			if got := l.selectedName(); got != tt.wantLast {
+				t.Errorf("after last: selectedName() = %q, want %q", got, tt.wantLast)
+			}
+
+			l.first()
+			if got := l.selectedName(); got != tt.wantFirst {
+				t.Errorf("after first: selectedName() = %q, want %q", got, tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestListSelectedBranch(t *testing.T) {
+	l := NewList(nil)
+	if b := l.selectedBranch(); b != nil {
+		t.Errorf("empty list: selectedBranch() = %v, want nil", b)
+	}
+
+	l = NewList(branches("a", "b"))
+	l.next()
+	if b := l.selectedBranch(); b == nil || b.Name != "b" {
+		t.Errorf("selectedBranch() = %v, want b", b)
+	}
+}
+
+func TestListMarks(t *testing.T) {
+	l := NewList(branches("a", "b", "c"))
+
+	l.last()
+	l.toggleMark()
+	l.first()
+	l.toggleMark()
+	l.next()
+	l.toggleMark()
+	l.toggleMark()
+
+	var got []string
+	for _, b := range l.markedBranches() {
+		got = append(got, b.Name)
+	}
+	if want := []string{"a", "c"}; !slices.Equal(got, want) {
+		t.Errorf("markedBranches() = %v, want %v", got, want)
+	}
+}
+
+func TestPartialEscape(t *testing.T) {
+	tests := []struct {
+		buf  string
+		want bool
+	}{
+		{"", false},
+		{"a", false},
+		{"\x1b", true},
+		{"\x1b[", true},
+		{"\x1b[A", false},
+		{"\x1b[5", true},
+		{"\x1b[5~", false},
+		{"\x1bO", true},
+		{"\x1bOH", false},
+		{"\x1ba", false},
+	}
+
+	for _, tt := range tests {
+		if got := partialEscape([]rune(tt.buf)); got != tt.want {
+			t.Errorf("partialEscape(%q) = %v, want %v", tt.buf, got, tt.want)
+		}
+	}
+}
+
+func TestCompactAge(t *testing.T) {
+	const day = 24 * time.Hour
+
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "now"},
+		{59 * time.Second, "now"},
+		{5 * time.Minute, "5m"},
+		{5 * time.Hour, "5h"},
+		{3 * day, "3d"},
+		{15 * day, "2w"},
+		{45 * day, "1mo"},
+		{400 * day, "1y"},
+	}
+
+	for _, tt := range tests {
+		if got := compactAge(tt.d); got != tt.want {
+			t.Errorf("compactAge(%s) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestListSkipHead(t *testing.T) {
+	tests := []struct {
+		name string
+		head int
+		want string
+	}{
+		{"first", 0, "b"},
+		{"other", 1, "a"},
+		{"last", 2, "a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bs := branches("a", "b", "c")
+			bs[tt.head].IsHead = true
+			l := NewList(bs)
+			l.skipHead()
+
+			if got := l.selectedName(); got != tt.want {
+				t.Errorf("selectedName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	l := NewList([]Branch{{Name: "a", IsHead: true}})
+	l.skipHead()
+	if got := l.selectedName(); got != "a" {
+		t.Errorf("only branch: selectedName() = %q, want a", got)
+	}
+}
+
+func TestNextSort(t *testing.T) {
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{"", "name"},
+		{"date", "name"},
+		{"name", "recent"},
+		{"recent", "date"},
+		{"name-desc", "date"},
+	}
+
+	for _, tt := range tests {
+		if got := nextSort(tt.mode); got != tt.want {
+			t.Errorf("nextSort(%q) = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+//go:build !windows
+
+package selector
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// waitForInput returns true when the given file has something to read, or false
+// if it doesn't within the timeout.
+func waitForInput(f *os.File, timeout time.Duration) (bool, error) {
+	fds := []unix.PollFd{{Fd: int32(f.Fd()), Events: unix.POLLIN}}
+
+	n, err := unix.Poll(fds, int(timeout.Milliseconds()))
+	if errors.Is(err, unix.EINTR) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unix.Poll: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+// watchResize returns a channel which receives when the terminal is resized,
+// and a func to stop watching.
+func watchResize(w io.Writer) (<-chan struct{}, func()) {
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+
+	resized := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-winch:
+				select {
+				case resized <- struct{}{}:
+				default:
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return resized, func() {
+		signal.Stop(winch)
+		close(done)
+	}
+}
+
+// enableVT prepares the terminal for the escape sequences used to draw the
+// prompt, and returns a func to undo it. Unix terminals don't need anything.
+func enableVT(w io.Writer) (func() error, error) {
+	return func() error { return nil }, nil
+}
@@ -0,0 +1,86 @@
+package selector
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// waitForInput returns true when the given console has something to read, or
+// false if it doesn't within the timeout.
+func waitForInput(f *os.File, timeout time.Duration) (bool, error) {
+	event, err := windows.WaitForSingleObject(windows.Handle(f.Fd()), uint32(timeout.Milliseconds()))
+	if err != nil {
+		return false, fmt.Errorf("windows.WaitForSingleObject: %w", err)
+	}
+
+	return event == windows.WAIT_OBJECT_0, nil
+}
+
+// watchResize returns a channel which receives when the console is resized,
+// and a func to stop watching. There's no SIGWINCH on Windows, so this polls.
+func watchResize(w io.Writer) (<-chan struct{}, func()) {
+	resized := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+
+		width, height := termSize(w)
+		for {
+			select {
+			case <-ticker.C:
+				wd, ht := termSize(w)
+				if wd == width && ht == height {
+					continue
+				}
+				width, height = wd, ht
+				select {
+				case resized <- struct{}{}:
+				default:
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return resized, func() { close(done) }
+}
+
+// enableVT turns on virtual terminal processing for the console which w writes
+// to, so that the escape sequences used to draw the prompt are interpreted
+// rather than printed, and returns a func to turn it off again. It does
+// nothing if w isn't a console.
+func enableVT(w io.Writer) (func() error, error) {
+	noop := func() error { return nil }
+
+	f, ok := w.(interface{ Fd() uintptr })
+	if !ok {
+		return noop, nil
+	}
+
+	h := windows.Handle(f.Fd())
+	var mode uint32
+	if err := windows.GetConsoleMode(h, &mode); err != nil {
+		return noop, nil
+	}
+	if mode&windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING != 0 {
+		return noop, nil
+	}
+
+	err := windows.SetConsoleMode(h, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING)
+	if err != nil {
+		return nil, fmt.Errorf("windows.SetConsoleMode: %w", err)
+	}
+
+	return func() error {
+		if err := windows.SetConsoleMode(h, mode); err != nil {
+			return fmt.Errorf("windows.SetConsoleMode: %w", err)
+		}
+		return nil
+	}, nil
+}
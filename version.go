@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// these are set when building a release, with:
+//
+//	go build -ldflags "-X main.version=v1.2.3 -X main.commit=abc1234 -X main.date=2024-09-14"
+//
+// otherwise they're filled in from the build info, if possible.
+var (
+	version = ""
+	commit  = ""
+	date    = ""
+)
+
+// versionString returns the version, commit, and build date of this binary, as
+// far as they're known.
+func versionString() string {
+	v, c, d := version, commit, date
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		// go install sets the module version, but older toolchains leave local
+		// builds as (devel).
+		if v == "" && info.Main.Version != "(devel)" {
+			v = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && c == "":
+				c = s.Value
+			case s.Key == "vcs.time" && d == "":
+				d = s.Value
+			}
+		}
+	}
+
+	if v == "" {
+		v = "unknown"
+	}
+	if len(c) > 12 {
+		c = c[:12]
+	}
+	if c == "" {
+		c = "unknown"
+	}
+	if d == "" {
+		d = "unknown"
+	}
+
+	return fmt.Sprintf("git-branch-selector %s (commit %s, built %s)", v, c, d)
+}